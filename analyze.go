@@ -0,0 +1,450 @@
+package pcre
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.elara.ws/pcre/lib"
+	"go.elara.ws/pcre/syntax"
+)
+
+// Severity represents how likely a construct is
+// to cause excessive backtracking.
+type Severity int
+
+const (
+	SeverityNone Severity = iota
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityNone:
+		return "none"
+	case SeverityLow:
+		return "low"
+	case SeverityMedium:
+		return "medium"
+	case SeverityHigh:
+		return "high"
+	default:
+		return "Severity(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// RiskKind represents a kind of risky construct
+type RiskKind int
+
+const (
+	// NestedQuantifier is reported for a repeated group that
+	// contains an unbounded quantifier, such as (a+)+
+	NestedQuantifier RiskKind = iota
+
+	// OverlappingAlternation is reported for a repeated group with
+	// alternatives that can start with the same character, such as (a|ab)*
+	OverlappingAlternation
+
+	// QuantifiedBackref is reported for a backreference
+	// that can be repeated, such as (a)(\1)*
+	QuantifiedBackref
+
+	// Recursion is reported for subroutine calls that can recurse,
+	// such as (?R), or (?1) within the first group
+	Recursion
+)
+
+// String returns a description of the risk kind
+func (rk RiskKind) String() string {
+	switch rk {
+	case NestedQuantifier:
+		return "nested unbounded quantifiers"
+	case OverlappingAlternation:
+		return "overlapping alternation under a quantifier"
+	case QuantifiedBackref:
+		return "backreference inside repetition"
+	case Recursion:
+		return "unbounded recursion"
+	default:
+		return "RiskKind(" + strconv.Itoa(int(rk)) + ")"
+	}
+}
+
+// Risk represents a risky construct found in a pattern
+type Risk struct {
+	Kind     RiskKind
+	Severity Severity
+	// Offset contains the offset of the construct within the pattern
+	Offset int
+}
+
+// String returns a textual representation of the risk
+func (r Risk) String() string {
+	return fmt.Sprintf("offset %d: %s: %s", r.Offset, r.Severity, r.Kind)
+}
+
+// Analysis contains the result of analyzing a pattern
+type Analysis struct {
+	// Risks contains the risky constructs found in the pattern,
+	// ordered by offset.
+	Risks []Risk
+
+	// MatchEmpty reports whether the pattern can match an empty string.
+	MatchEmpty bool
+
+	// MaxLookbehind contains the length of the longest lookbehind
+	// in the pattern, in characters.
+	MaxLookbehind uint32
+
+	// BackrefMax contains the number of the highest
+	// backreference in the pattern, or zero if there are none.
+	BackrefMax uint32
+}
+
+// Severity returns the highest severity of all the risks found,
+// or SeverityNone if no risks were found.
+func (a *Analysis) Severity() Severity {
+	out := SeverityNone
+	for _, risk := range a.Risks {
+		if risk.Severity > out {
+			out = risk.Severity
+		}
+	}
+	return out
+}
+
+// Analyze runs AnalyzeOpts with no options.
+func Analyze(pattern string) (*Analysis, error) {
+	return AnalyzeOpts(pattern, 0)
+}
+
+// AnalyzeOpts validates the pattern by compiling it with the given options,
+// and then looks for constructs that may cause excessive backtracking
+// in its syntax tree, as parsed by the syntax package.
+//
+// The analysis is heuristic. It may report constructs that are harmless
+// in practice, and cannot find every pattern with exponential runtime.
+// It is meant as a gate for patterns from configuration, to be used
+// alongside match limits.
+func AnalyzeOpts(pattern string, options CompileOption) (*Analysis, error) {
+	r, err := CompileOpts(pattern, options)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	tree, err := syntax.Parse(pattern, syntax.Flags(options))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Analysis{
+		MatchEmpty:    r.patternInfo(lib.DPCRE2_INFO_MATCHEMPTY) != 0,
+		MaxLookbehind: r.patternInfo(lib.DPCRE2_INFO_MAXLOOKBEHIND),
+		BackrefMax:    r.patternInfo(lib.DPCRE2_INFO_BACKREFMAX),
+	}
+
+	an := newAnalyzer(tree)
+	an.walk(tree, nil)
+	a.Risks = an.risks
+
+	sort.SliceStable(a.Risks, func(i, j int) bool {
+		return a.Risks[i].Offset < a.Risks[j].Offset
+	})
+
+	return a, nil
+}
+
+// lead describes the first character an alternative can match.
+// A nil lead means the alternative can match an empty string.
+type lead struct {
+	// any is set if the first character is unknown
+	any bool
+	// class contains 'd', 'w' or 's' for the corresponding
+	// escape sequences, or zero if the lead is not a class.
+	class byte
+	// lit contains the literal first character
+	lit      rune
+	caseless bool
+}
+
+var anyLead = &lead{any: true}
+
+// overlaps reports whether the two leads can match the same character
+func (l *lead) overlaps(o *lead) bool {
+	if l == nil || o == nil || l.any || o.any {
+		return true
+	}
+
+	switch {
+	case l.class != 0 && o.class != 0:
+		return l.class == o.class || l.class != 's' && o.class != 's'
+	case l.class != 0:
+		return classHas(l.class, o.lit)
+	case o.class != 0:
+		return classHas(o.class, l.lit)
+	case l.caseless || o.caseless:
+		return strings.EqualFold(string(l.lit), string(o.lit))
+	default:
+		return l.lit == o.lit
+	}
+}
+
+// classHas reports whether c is a member of the given class
+func classHas(class byte, c rune) bool {
+	isDigit := c >= '0' && c <= '9'
+	switch class {
+	case 'd':
+		return isDigit
+	case 'w':
+		return isDigit || c == '_' || (c|0x20) >= 'a' && (c|0x20) <= 'z' || c >= 0x80
+	case 's':
+		return strings.ContainsRune(" \t\n\v\f\r", c) || c >= 0x80
+	}
+	return true
+}
+
+// leadOf returns the lead of n, or nil if n can match an empty string
+func leadOf(n *syntax.Node) *lead {
+	switch n.Op {
+	case syntax.OpEmpty:
+		return nil
+	case syntax.OpLiteral:
+		return &lead{lit: n.Rune, caseless: n.Flags&syntax.Caseless != 0}
+	case syntax.OpCharType:
+		switch n.Text {
+		case `\d`, `\w`, `\s`:
+			return &lead{class: n.Text[1]}
+		}
+	case syntax.OpConcat:
+		for _, sub := range n.Sub {
+			if !zeroWidth(sub) {
+				return leadOf(sub)
+			}
+		}
+		return nil
+	case syntax.OpGroup:
+		if n.Sub[0].Op != syntax.OpAlternate {
+			return leadOf(n.Sub[0])
+		}
+	case syntax.OpRepeat:
+		if n.Min > 0 {
+			return leadOf(n.Sub[0])
+		}
+	}
+	return anyLead
+}
+
+// zeroWidth reports whether n matches without consuming characters
+func zeroWidth(n *syntax.Node) bool {
+	switch n.Op {
+	case syntax.OpAssertion, syntax.OpResetMatchStart, syntax.OpVerb, syntax.OpCallout, syntax.OpOptions:
+		return true
+	case syntax.OpGroup:
+		return n.Group.IsLookaround()
+	}
+	return false
+}
+
+// overlapping reports whether any two alternatives of n
+// can start with the same character
+func overlapping(n *syntax.Node) bool {
+	if n.Op != syntax.OpAlternate {
+		return false
+	}
+
+	leads := make([]*lead, len(n.Sub))
+	for i, sub := range n.Sub {
+		leads[i] = leadOf(sub)
+	}
+	for i := range leads {
+		for j := i + 1; j < len(leads); j++ {
+			if leads[i].overlaps(leads[j]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// atomicGroup reports whether groups of the given kind
+// can't be backtracked into once they've matched
+func atomicGroup(kind syntax.GroupKind) bool {
+	switch kind {
+	case syntax.GroupAtomic, syntax.GroupAtomicScriptRun,
+		syntax.GroupLookahead, syntax.GroupNegativeLookahead,
+		syntax.GroupLookbehind, syntax.GroupNegativeLookbehind:
+		return true
+	}
+	return false
+}
+
+// quantifiers reports whether n contains quantifiers that can be
+// backtracked into, either unbounded ones such as a+, or bounded ones
+// that can repeat a varying number of times, such as a{1,5}.
+func quantifiers(n *syntax.Node) (unbounded, bounded bool) {
+	syntax.Walk(n, func(n *syntax.Node) bool {
+		switch {
+		case n.Op == syntax.OpGroup && atomicGroup(n.Group):
+			return false
+		case n.Op == syntax.OpRepeat && n.Mode != syntax.Possessive:
+			if n.Max == -1 {
+				unbounded = true
+			} else if n.Max > 1 && n.Max > n.Min {
+				bounded = true
+			}
+		}
+		return true
+	})
+	return unbounded, bounded
+}
+
+// hasBackref reports whether n contains a backreference
+func hasBackref(n *syntax.Node) bool {
+	found := false
+	syntax.Walk(n, func(n *syntax.Node) bool {
+		found = found || n.Op == syntax.OpBackref
+		return !found
+	})
+	return found
+}
+
+// analyzer looks for risky constructs in a syntax tree
+type analyzer struct {
+	root  *syntax.Node
+	risks []Risk
+
+	// groups and names contain the capturing
+	// groups by number and by name
+	groups map[int]*syntax.Node
+	names  map[string]*syntax.Node
+}
+
+func newAnalyzer(root *syntax.Node) *analyzer {
+	an := &analyzer{
+		root:   root,
+		groups: map[int]*syntax.Node{},
+		names:  map[string]*syntax.Node{},
+	}
+	syntax.Walk(root, func(n *syntax.Node) bool {
+		if n.Op == syntax.OpGroup && n.Group == syntax.GroupCapture {
+			// Groups in a branch reset group may share a number
+			if _, ok := an.groups[n.Index]; !ok {
+				an.groups[n.Index] = n
+			}
+			if n.Name != "" {
+				an.names[n.Name] = n
+			}
+		}
+		return true
+	})
+	return an
+}
+
+func (an *analyzer) report(kind RiskKind, sev Severity, offset int) {
+	an.risks = append(an.risks, Risk{Kind: kind, Severity: sev, Offset: offset})
+}
+
+// walk reports the risks found in the tree rooted at n.
+// enclosing contains the capturing groups that contain n.
+func (an *analyzer) walk(n *syntax.Node, enclosing []*syntax.Node) {
+	switch n.Op {
+	case syntax.OpRepeat:
+		an.repeat(n)
+	case syntax.OpRecursion:
+		if an.recursive(n, enclosing) {
+			an.report(Recursion, SeverityMedium, n.Pos)
+		}
+	case syntax.OpGroup:
+		if n.Group == syntax.GroupCapture {
+			enclosing = append(enclosing[:len(enclosing):len(enclosing)], n)
+		}
+	}
+
+	if n.Cond != nil {
+		an.walk(n.Cond, enclosing)
+	}
+	for _, sub := range n.Sub {
+		an.walk(sub, enclosing)
+	}
+}
+
+// repeat reports the risks of the repetition n
+func (an *analyzer) repeat(n *syntax.Node) {
+	unbounded := n.Max == -1
+	if !unbounded && n.Max <= 1 {
+		return
+	}
+	sub := n.Sub[0]
+
+	if n.Mode != syntax.Possessive && !(sub.Op == syntax.OpGroup && atomicGroup(sub.Group)) {
+		sev := SeverityMedium
+		if unbounded {
+			sev = SeverityHigh
+		}
+
+		// Bounded quantifiers can only cause exponential
+		// backtracking when repeated without a bound.
+		inner, bounded := quantifiers(sub)
+		if inner || unbounded && bounded {
+			an.report(NestedQuantifier, sev, sub.Pos)
+		}
+		if sub.Op == syntax.OpGroup && overlapping(sub.Sub[0]) {
+			an.report(OverlappingAlternation, sev, sub.Pos)
+		}
+	}
+
+	if hasBackref(sub) {
+		an.report(QuantifiedBackref, SeverityMedium, sub.Pos)
+	}
+}
+
+// target returns the group called by the subroutine call n,
+// or nil if it doesn't exist. (?R) calls the root of the tree.
+func (an *analyzer) target(n *syntax.Node) *syntax.Node {
+	switch {
+	case n.Name != "":
+		return an.names[n.Name]
+	case n.Index == 0:
+		return an.root
+	default:
+		return an.groups[n.Index]
+	}
+}
+
+// recursive reports whether the subroutine call n, which is inside
+// the enclosing groups, can call itself again, which is the case if
+// the group it calls can reach one of them through subroutine calls.
+func (an *analyzer) recursive(n *syntax.Node, enclosing []*syntax.Node) bool {
+	inside := map[*syntax.Node]bool{an.root: true}
+	for _, g := range enclosing {
+		inside[g] = true
+	}
+
+	visited := map[*syntax.Node]bool{}
+	var reaches func(g *syntax.Node) bool
+	reaches = func(g *syntax.Node) bool {
+		if g == nil || inside[g] {
+			// Calls to groups that don't exist are assumed to recurse
+			return true
+		}
+		if visited[g] {
+			return false
+		}
+		visited[g] = true
+
+		found := false
+		syntax.Walk(g, func(c *syntax.Node) bool {
+			if !found && c.Op == syntax.OpRecursion {
+				found = reaches(an.target(c))
+			}
+			return !found
+		})
+		return found
+	}
+	return reaches(an.target(n))
+}
@@ -0,0 +1,93 @@
+package pcre_test
+
+import (
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestAnalyze(t *testing.T) {
+	type risk struct {
+		kind     pcre.RiskKind
+		severity pcre.Severity
+		offset   int
+	}
+
+	tests := []struct {
+		pattern string
+		options pcre.CompileOption
+		risks   []risk
+	}{
+		{`(a+)+$`, 0, []risk{{pcre.NestedQuantifier, pcre.SeverityHigh, 0}}},
+		{`x(b*){3}`, 0, []risk{{pcre.NestedQuantifier, pcre.SeverityMedium, 1}}},
+		{`(?>a+)+`, 0, nil},
+		{`(a++)+`, 0, nil},
+		{`(a|aa)+$`, 0, []risk{{pcre.OverlappingAlternation, pcre.SeverityHigh, 0}}},
+		{`(a|b)+`, 0, nil},
+		{`(A|a)+`, 0, nil},
+		{`(A|a)+`, pcre.Caseless, []risk{{pcre.OverlappingAlternation, pcre.SeverityHigh, 0}}},
+		{`(\d|\w)*`, 0, []risk{{pcre.OverlappingAlternation, pcre.SeverityHigh, 0}}},
+		{`(a)(\1)*`, 0, []risk{{pcre.QuantifiedBackref, pcre.SeverityMedium, 3}}},
+		{`(\((?R)?\))`, 0, []risk{{pcre.Recursion, pcre.SeverityMedium, 3}}},
+		{`(?<n>a(?&n)?b)`, 0, []risk{{pcre.Recursion, pcre.SeverityMedium, 6}}},
+		{`(a(?2))(b(?1)?)`, 0, []risk{{pcre.Recursion, pcre.SeverityMedium, 2}, {pcre.Recursion, pcre.SeverityMedium, 9}}},
+		{`(?<n>x)(?&n)`, 0, nil},
+		{`(?1)(a)`, 0, nil},
+		{`(a{1,5})+`, 0, []risk{{pcre.NestedQuantifier, pcre.SeverityHigh, 0}}},
+		{`(a{1,5}){3}`, 0, nil},
+		{`(ab?)+`, 0, nil},
+		{`( a + ) * # comment`, pcre.Extended, []risk{{pcre.NestedQuantifier, pcre.SeverityHigh, 0}}},
+		{`\Q(a+)+\E`, 0, nil},
+		{`(a+)+`, pcre.Literal, nil},
+		{`[(]+(a*)*`, 0, []risk{{pcre.NestedQuantifier, pcre.SeverityHigh, 4}}},
+		{`(?(?=a)(a+)+|b)`, 0, []risk{{pcre.NestedQuantifier, pcre.SeverityHigh, 7}}},
+	}
+
+	for _, test := range tests {
+		a, err := pcre.AnalyzeOpts(test.pattern, test.options)
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err)
+			continue
+		}
+
+		if len(a.Risks) != len(test.risks) {
+			t.Errorf("%s: expected %d risks, got %v", test.pattern, len(test.risks), a.Risks)
+			continue
+		}
+
+		for i, expected := range test.risks {
+			got := a.Risks[i]
+			if got.Kind != expected.kind || got.Severity != expected.severity || got.Offset != expected.offset {
+				t.Errorf("%s: expected %v, got %v", test.pattern, expected, got)
+			}
+		}
+	}
+}
+
+func TestAnalyzeInfo(t *testing.T) {
+	a, err := pcre.Analyze(`(a)(?<=bc)\1*`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.MatchEmpty {
+		t.Error("expected pattern not to match empty string")
+	}
+
+	if a.MaxLookbehind != 2 {
+		t.Errorf("expected max lookbehind 2, got %d", a.MaxLookbehind)
+	}
+
+	if a.BackrefMax != 1 {
+		t.Errorf("expected max backreference 1, got %d", a.BackrefMax)
+	}
+
+	if a.Severity() != pcre.SeverityMedium {
+		t.Errorf("expected medium severity, got %s", a.Severity())
+	}
+
+	_, err = pcre.Analyze(`(`)
+	if err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,329 @@
+package pcre
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre/syntax"
+)
+
+// re2Options contains the compile options that can be
+// expressed in Go's regexp package, mapped to their flags.
+var re2Options = map[CompileOption]string{
+	Caseless:      "i",
+	Multiline:     "m",
+	DotAll:        "s",
+	Ungreedy:      "U",
+	UTF:           "",
+	DollarEndOnly: "",
+	AltCircumflex: "",
+}
+
+// CompileAuto compiles the provided pattern using the given options. If
+// the pattern can be expressed in Go's regexp package with the same meaning,
+// it is compiled with that package, which guarantees linear-time matching.
+// Otherwise, it is compiled with CompileOpts. The pcre2 engine is used for
+// features such as lookarounds, backreferences, atomic groups, possessive
+// quantifiers, and for any pattern Go's regexp package rejects.
+//
+// The returned Matcher is either a *Regexp or a *StdRegexp, so a type
+// assertion can be used to find out which engine was selected.
+//
+// When the UTF option is not set, pcre2 matches bytes instead of UTF-8
+// characters, so CompileAuto only selects Go's regexp package for patterns
+// whose matches consist of at least one ASCII character and nothing else,
+// which can't start or end within a multibyte character. Patterns with
+// dots, negated classes or matches that may be empty use pcre2. When the
+// UTF option is set, Go's regexp package accepts subjects with invalid
+// UTF-8, while pcre2 reports an error.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func CompileAuto(pattern string, options CompileOption) (Matcher, error) {
+	if expr, ok := toRE2(pattern, options); ok {
+		r, err := regexp.Compile(expr)
+		if err == nil {
+			return &StdRegexp{Regexp: r, expr: pattern}, nil
+		}
+	}
+	return CompileOpts(pattern, options)
+}
+
+// MustCompileAuto compiles the given pattern using CompileAuto
+// and panics if there was an error.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func MustCompileAuto(pattern string, options CompileOption) Matcher {
+	m, err := CompileAuto(pattern, options)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// splice represents a replacement of part of a pattern
+type splice struct {
+	pos, end int
+	text     string
+}
+
+// toRE2 converts the pattern to the syntax of Go's regexp package, if it
+// can be expressed there with the same meaning. Otherwise, it returns false.
+func toRE2(pattern string, options CompileOption) (string, bool) {
+	flags := ""
+	for opt := CompileOption(1); opt != 0; opt <<= 1 {
+		if options&opt == 0 {
+			continue
+		}
+		flag, ok := re2Options[opt]
+		if !ok {
+			return "", false
+		}
+		flags += flag
+	}
+
+	utf := options&UTF != 0
+	if !utf && !isASCII(pattern) {
+		return "", false
+	}
+
+	tree, err := syntax.Parse(pattern, syntax.Flags(options))
+	if err != nil {
+		return "", false
+	}
+	if !utf && !matchesWholeRunes(tree) {
+		return "", false
+	}
+
+	var splices []splice
+	ok := true
+	syntax.Walk(tree, func(n *syntax.Node) bool {
+		if !ok {
+			return false
+		}
+
+		src := pattern[n.Pos:n.End]
+		switch n.Op {
+		case syntax.OpEmpty, syntax.OpAnyChar, syntax.OpProperty, syntax.OpConcat, syntax.OpAlternate:
+		case syntax.OpLiteral:
+			switch {
+			case !utf && n.Rune >= utf8.RuneSelf:
+				// pcre2 matches a byte, but Go would match a UTF-8 character
+				ok = false
+			case len(src) > 1 && src[0] == '\\':
+				// Escape sequences differ between the engines,
+				// so they are replaced with hexadecimal escapes.
+				splices = append(splices, splice{n.Pos, n.End, `\x{` + strconv.FormatInt(int64(n.Rune), 16) + `}`})
+			case strings.ContainsRune(`\.+*?()|[{^$`, n.Rune):
+				// Unescaped metacharacters are either quoted with \Q...\E
+				// or literal due to pcre2-specific rules, such as in a{,3}.
+				ok = false
+			}
+		case syntax.OpCharClass:
+			ok = re2Class(n, utf, &splices)
+		case syntax.OpCharType:
+			switch src {
+			case `\d`, `\D`, `\w`, `\W`:
+				ok = options&UCP == 0
+			case `\s`:
+				// pcre2 includes vertical tab in \s, but Go does not
+				splices = append(splices, splice{n.Pos, n.End, `[\t\n\v\f\r ]`})
+			case `\S`:
+				splices = append(splices, splice{n.Pos, n.End, `[^\t\n\v\f\r ]`})
+			default:
+				ok = false
+			}
+		case syntax.OpAssertion:
+			switch src {
+			case `\A`, `\z`:
+			case `\b`, `\B`:
+				ok = options&UCP == 0
+			case "^":
+				// pcre2 doesn't match ^ after a trailing newline
+				// in multiline mode unless AltCircumflex is set.
+				ok = n.Flags&syntax.Multiline == 0 || options&AltCircumflex != 0
+			case "$":
+				// pcre2 matches $ before a trailing newline
+				// unless in multiline or DollarEndOnly mode.
+				ok = n.Flags&syntax.Multiline != 0 || options&DollarEndOnly != 0
+			default:
+				ok = false
+			}
+		case syntax.OpRepeat:
+			ok = n.Mode != syntax.Possessive
+		case syntax.OpGroup:
+			switch n.Group {
+			case syntax.GroupCapture:
+			case syntax.GroupNonCapture:
+				ok = re2InlineOptions(n.Text)
+			default:
+				ok = false
+			}
+		case syntax.OpOptions:
+			ok = re2InlineOptions(n.Text)
+		default:
+			ok = false
+		}
+		return ok
+	})
+	if !ok {
+		return "", false
+	}
+
+	// Apply the splices from the end so that offsets stay valid
+	sort.Slice(splices, func(i, j int) bool {
+		return splices[i].pos > splices[j].pos
+	})
+	for _, s := range splices {
+		pattern = pattern[:s.pos] + s.text + pattern[s.end:]
+	}
+
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return pattern, true
+}
+
+// matchesWholeRunes reports whether every match of a tree parsed without
+// the UTF flag consists of at least one ASCII character and nothing else.
+// pcre2 matches such patterns byte by byte like Go's regexp package matches
+// them rune by rune, as their matches can't start or end in the middle of
+// a multibyte character.
+func matchesWholeRunes(tree *syntax.Node) bool {
+	ok := true
+	syntax.Walk(tree, func(n *syntax.Node) bool {
+		if !ok {
+			return false
+		}
+
+		caseless := n.Flags&syntax.Caseless != 0
+		switch n.Op {
+		case syntax.OpAnyChar, syntax.OpProperty:
+			ok = false
+		case syntax.OpLiteral:
+			// Go folds k and s to the Kelvin and long s signs
+			ok = n.Rune < utf8.RuneSelf && !(caseless && strings.ContainsRune("kKsS", n.Rune))
+		case syntax.OpCharClass:
+			ok = !n.Negated && !caseless && !strings.Contains(n.Text, "[:^")
+			for _, neg := range []string{`\D`, `\W`, `\S`, `\p`, `\P`} {
+				ok = ok && !strings.Contains(n.Text, neg)
+			}
+		case syntax.OpCharType:
+			ok = n.Text != `\D` && n.Text != `\W` && n.Text != `\S`
+		}
+		return ok
+	})
+	return ok && minLength(tree) > 0
+}
+
+// minLength returns the minimum number of
+// characters in a match of the tree.
+func minLength(n *syntax.Node) int {
+	switch n.Op {
+	case syntax.OpLiteral, syntax.OpAnyChar, syntax.OpCharClass, syntax.OpCharType, syntax.OpProperty:
+		return 1
+	case syntax.OpConcat, syntax.OpGroup:
+		total := 0
+		for _, sub := range n.Sub {
+			total += minLength(sub)
+		}
+		return total
+	case syntax.OpAlternate:
+		shortest := -1
+		for _, sub := range n.Sub {
+			if l := minLength(sub); shortest == -1 || l < shortest {
+				shortest = l
+			}
+		}
+		if shortest == -1 {
+			return 0
+		}
+		return shortest
+	case syntax.OpRepeat:
+		return n.Min * minLength(n.Sub[0])
+	default:
+		return 0
+	}
+}
+
+// re2Class checks whether a character class can be used in Go's regexp
+// package, adding splices for escape sequences that need to be replaced.
+func re2Class(n *syntax.Node, utf bool, splices *[]splice) bool {
+	class := n.Text
+	for i := 0; i < len(class); i++ {
+		if class[i] != '\\' || i+1 >= len(class) {
+			continue
+		}
+		i++
+
+		switch c := class[i]; {
+		case c == 's':
+			*splices = append(*splices, splice{n.Pos + i - 1, n.Pos + i + 1, `\t\n\v\f\r `})
+		case strings.IndexByte("dDwWtnrfa", c) != -1:
+		case c == 'x':
+			if !utf && !re2ClassHex(class[i+1:]) {
+				return false
+			}
+		case c == 'p' || c == 'P':
+			// Go's regexp package validates property names
+		case !isAlnum(c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// re2ClassHex reports whether the hexadecimal escape at the start
+// of s is an ASCII character, which is the same in both engines.
+func re2ClassHex(s string) bool {
+	digits := s
+	if strings.HasPrefix(s, "{") {
+		end := strings.IndexByte(s, '}')
+		if end == -1 {
+			return false
+		}
+		digits = s[1:end]
+	} else {
+		n := 0
+		for n < len(s) && n < 2 && isHex(s[n]) {
+			n++
+		}
+		digits = s[:n]
+	}
+
+	v, err := strconv.ParseUint(digits, 16, 32)
+	return err == nil && v < utf8.RuneSelf
+}
+
+// re2InlineOptions reports whether the inline option
+// letters are supported by Go's regexp package.
+func re2InlineOptions(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if strings.IndexByte("imsU-", text[i]) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || (c|0x20) >= 'a' && (c|0x20) <= 'z'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || (c|0x20) >= 'a' && (c|0x20) <= 'f'
+}
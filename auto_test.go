@@ -0,0 +1,123 @@
+package pcre_test
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre"
+)
+
+func TestCompileAuto(t *testing.T) {
+	tests := []struct {
+		pattern string
+		options pcre.CompileOption
+		pcre    bool
+	}{
+		{`\d+-[a-z]+`, 0, false},
+		{`(?P<year>\d{4})-(\d{2})`, 0, false},
+		{`(?i)hello|wor?ld`, 0, false},
+		{`\s+\S`, pcre.UTF, false},
+		{`[\s\d]+`, 0, false},
+		{`\x41\t`, 0, false},
+		{`^a$`, pcre.Multiline | pcre.AltCircumflex, false},
+		{`a$`, pcre.DollarEndOnly, false},
+		{`é+`, pcre.UTF, false},
+		{`\d+(?= USD)`, 0, true},
+		{`(?<!x)y`, 0, true},
+		{`(a)\1`, 0, true},
+		{`a++`, 0, true},
+		{`(?>a+)b`, 0, true},
+		{`a$`, 0, true},
+		{`^a`, pcre.Multiline, true},
+		{`\h\R`, 0, true},
+		{`[\v]`, 0, true},
+		{`\Qa.b\E`, 0, true},
+		{`a{,3}`, 0, true},
+		{`é`, 0, true},
+		{`[\xff]`, 0, true},
+		{`\d`, pcre.UCP, true},
+		{`a`, pcre.Extended, true},
+		{`a(?x) b`, 0, true},
+		{`a(?#comment)`, 0, true},
+		{`a{1001}`, 0, true},
+		// Without UTF, matches could start or end within a character
+		{`a.b`, 0, true},
+		{`[^a]`, 0, true},
+		{`\S`, 0, true},
+		{`[\W]`, 0, true},
+		{`x*`, 0, true},
+		{`a|`, 0, true},
+		{`(?i)k`, 0, true},
+		{`[a-z]`, pcre.Caseless, true},
+	}
+
+	for _, test := range tests {
+		m, err := pcre.CompileAuto(test.pattern, test.options)
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err)
+			continue
+		}
+
+		if _, ok := m.(*pcre.Regexp); ok != test.pcre {
+			t.Errorf("%s: expected pcre2 engine: %t, got %t", test.pattern, test.pcre, ok)
+		}
+		if m.String() != test.pattern {
+			t.Errorf("%s: String() returned %s", test.pattern, m.String())
+		}
+		m.Close()
+	}
+
+	_, err := pcre.CompileAuto(`(`, 0)
+	if err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestCompileAutoResults(t *testing.T) {
+	tests := []struct {
+		pattern string
+		options pcre.CompileOption
+		subject string
+	}{
+		{`(\w+)@(\w+)\.com`, 0, "a@b.com, cd@ef.com"},
+		{`\s+`, 0, "a \v\tb\n c"},
+		{`[^\s,]+`, pcre.UTF, "a,\vb c"},
+		{`\x2e\n`, 0, "a.\nb.\n"},
+		{`^\w+$`, pcre.Multiline | pcre.AltCircumflex, "ab\ncd\n"},
+		{`A.B`, pcre.Caseless | pcre.DotAll | pcre.UTF, "a\nb"},
+		{`a+?`, pcre.Ungreedy, "aaa"},
+		{`é+`, pcre.UTF, "éé e é"},
+		{`[^a]`, pcre.UTF, "aéa"},
+		{`x*`, pcre.UTF, "éxé"},
+		{`(?i)hello`, 0, "HELLO"},
+	}
+
+	// Subjects with multibyte characters, which pcre2 matches byte
+	// by byte without UTF, and invalid UTF-8 for Go's regexp package.
+	nonASCII := []string{"é", "aé\xffb", "k \u212a s \u017f", "\xe2\x80 \t\u00a0x"}
+
+	for _, test := range tests {
+		auto := pcre.MustCompileAuto(test.pattern, test.options)
+		if _, ok := auto.(*pcre.Regexp); ok {
+			t.Errorf("%s: expected Go's regexp package to be selected", test.pattern)
+		}
+
+		r := pcre.MustCompileOpts(test.pattern, test.options)
+
+		for _, subject := range append([]string{test.subject}, nonASCII...) {
+			if test.options&pcre.UTF != 0 && !utf8.ValidString(subject) {
+				// pcre2 rejects invalid UTF-8 in UTF mode
+				continue
+			}
+			expected := r.FindAllStringSubmatchIndex(subject, -1)
+			got := auto.FindAllStringSubmatchIndex(subject, -1)
+			if !reflect.DeepEqual(expected, got) {
+				t.Errorf("%s: %q: expected %v, got %v", test.pattern, subject, expected, got)
+			}
+		}
+
+		auto.Close()
+		r.Close()
+	}
+}
@@ -0,0 +1,137 @@
+package pcre
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// BudgetResource represents a resource limited by a Budget
+type BudgetResource int
+
+const (
+	// PatternMemory is memory used by compiled
+	// expressions, including compiling them.
+	PatternMemory BudgetResource = iota
+	// MatchMemory is memory used while matching, such as
+	// for match data and backtracking information.
+	MatchMemory
+	// LiveRegexps is the number of expressions that
+	// have been compiled but not closed.
+	LiveRegexps
+)
+
+// String returns the name of the resource
+func (br BudgetResource) String() string {
+	switch br {
+	case PatternMemory:
+		return "pattern memory"
+	case MatchMemory:
+		return "match memory"
+	case LiveRegexps:
+		return "live regexps"
+	default:
+		return fmt.Sprintf("BudgetResource(%d)", int(br))
+	}
+}
+
+// Budget limits the resources used by all the expressions compiled
+// with it, so that a group of expressions, such as ones provided by
+// an untrusted source, can't exhaust the resources of the process.
+// A limit of zero means that the resource is not limited.
+//
+// Compiling fails with a *BudgetError if the budget would be exceeded.
+// Matching fails with a *BudgetError if it needs more match memory
+// than is available. Methods that don't return errors panic with it,
+// in the same way as they panic on other errors.
+// The memory used by a single match can also be limited using
+// SetHeapLimit.
+//
+// A Budget is safe for concurrent use, and must not be
+// copied or have its limits changed once it has been used.
+type Budget struct {
+	patternMemory int64
+	matchMemory   int64
+	regexps       int64
+
+	// MaxPatternMemory is the maximum number of bytes used
+	// by compiled expressions.
+	MaxPatternMemory int64
+
+	// MaxMatchMemory is the maximum number of bytes used by
+	// matches that are running or kept for reuse.
+	MaxMatchMemory int64
+
+	// MaxRegexps is the maximum number of expressions that
+	// have been compiled but not closed.
+	MaxRegexps int
+}
+
+// BudgetUsage contains the resources currently used from a Budget
+type BudgetUsage struct {
+	// PatternMemory is the number of bytes used by compiled expressions
+	PatternMemory int64
+	// MatchMemory is the number of bytes used by matches
+	MatchMemory int64
+	// Regexps is the number of expressions that are not closed
+	Regexps int
+}
+
+// Usage returns the resources currently used from the budget
+func (b *Budget) Usage() BudgetUsage {
+	return BudgetUsage{
+		PatternMemory: atomic.LoadInt64(&b.patternMemory),
+		MatchMemory:   atomic.LoadInt64(&b.matchMemory),
+		Regexps:       int(atomic.LoadInt64(&b.regexps)),
+	}
+}
+
+// resource returns a pointer to the amount used of the
+// given resource, as well as the limit of the resource.
+func (b *Budget) resource(res BudgetResource) (used *int64, limit int64) {
+	switch res {
+	case PatternMemory:
+		return &b.patternMemory, b.MaxPatternMemory
+	case MatchMemory:
+		return &b.matchMemory, b.MaxMatchMemory
+	default:
+		return &b.regexps, int64(b.MaxRegexps)
+	}
+}
+
+// reserve adds n to the amount used of the given resource,
+// unless that would exceed its limit. It reports whether
+// the amount was added.
+func (b *Budget) reserve(res BudgetResource, n int64) bool {
+	used, limit := b.resource(res)
+	if atomic.AddInt64(used, n) > limit && limit > 0 {
+		atomic.AddInt64(used, -n)
+		return false
+	}
+	return true
+}
+
+// release subtracts n from the amount used of the given resource
+func (b *Budget) release(res BudgetResource, n int64) {
+	used, _ := b.resource(res)
+	atomic.AddInt64(used, -n)
+}
+
+// exceeded returns an error reporting that the
+// limit of the given resource was exceeded.
+func (b *Budget) exceeded(res BudgetResource) *BudgetError {
+	_, limit := b.resource(res)
+	return &BudgetError{Resource: res, Limit: limit}
+}
+
+// BudgetError is returned when a Budget would be exceeded
+type BudgetError struct {
+	// Resource is the resource whose limit would be exceeded
+	Resource BudgetResource
+	// Limit is the limit of the resource
+	Limit int64
+}
+
+// Error returns the error message
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s budget of %d exceeded", e.Resource, e.Limit)
+}
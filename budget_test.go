@@ -0,0 +1,177 @@
+package pcre_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestBudgetRegexps(t *testing.T) {
+	budget := &pcre.Budget{MaxRegexps: 2}
+	config := pcre.CompileConfig{Budget: budget}
+
+	r1, err := pcre.CompileWith(`a`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := pcre.CompileWith(`b`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+
+	_, err = pcre.CompileWith(`c`, config)
+	var be *pcre.BudgetError
+	if !errors.As(err, &be) || be.Resource != pcre.LiveRegexps || be.Limit != 2 {
+		t.Fatalf("expected live regexps budget error, got %v", err)
+	}
+
+	if _, err := r2.CloneErr(); !errors.As(err, &be) || be.Resource != pcre.LiveRegexps {
+		t.Errorf("expected CloneErr to return budget error, got %v", err)
+	}
+
+	// Closing an expression makes room for another
+	r1.Close()
+	r1.Close()
+	if usage := budget.Usage(); usage.Regexps != 1 {
+		t.Errorf("expected 1 live regexp, got %d", usage.Regexps)
+	}
+
+	r3, err := pcre.CompileWith(`c`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r3.Close()
+
+	// Failed compilations don't use the budget
+	if _, err := pcre.CompileWith(`(`, config); err == nil {
+		t.Error("expected compile error")
+	}
+	if usage := budget.Usage(); usage.Regexps != 1 {
+		t.Errorf("expected 1 live regexp, got %d", usage.Regexps)
+	}
+}
+
+func TestBudgetPatternMemory(t *testing.T) {
+	budget := &pcre.Budget{MaxPatternMemory: 4096}
+	config := pcre.CompileConfig{Budget: budget}
+
+	r, err := pcre.CompileWith(`\d+-\d+`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage := budget.Usage(); usage.PatternMemory <= 0 || usage.PatternMemory > 4096 {
+		t.Errorf("expected pattern memory to be recorded, got %d", usage.PatternMemory)
+	}
+
+	_, err = pcre.CompileWith(strings.Repeat(`(?:abc|def)`, 500), config)
+	var be *pcre.BudgetError
+	if !errors.As(err, &be) || be.Resource != pcre.PatternMemory {
+		t.Fatalf("expected pattern memory budget error, got %v", err)
+	}
+
+	r.Close()
+	if usage := budget.Usage(); usage != (pcre.BudgetUsage{}) {
+		t.Errorf("expected all resources to be released, got %+v", usage)
+	}
+}
+
+func TestBudgetMatchMemory(t *testing.T) {
+	budget := &pcre.Budget{MaxMatchMemory: 64 * 1024}
+
+	r, err := pcre.CompileWith(`(?:(a)|b)*c`, pcre.CompileConfig{Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.MatchString("abc") {
+		t.Error("expected abc to match")
+	}
+
+	// Deep backtracking needs more memory than the budget allows
+	func() {
+		defer func() {
+			var be *pcre.BudgetError
+			if err, _ := recover().(error); !errors.As(err, &be) || be.Resource != pcre.MatchMemory {
+				t.Errorf("expected match memory budget error, got %v", err)
+			}
+		}()
+		r.MatchString(strings.Repeat("ab", 100000) + "c")
+	}()
+
+	// The memory is released after the match
+	if !r.MatchString("abc") {
+		t.Error("expected abc to match")
+	}
+	if usage := budget.Usage(); usage.MatchMemory <= 0 || usage.MatchMemory > 64*1024 {
+		t.Errorf("expected match state to be recorded, got %d", usage.MatchMemory)
+	}
+
+	// Match states in use are released when the expression is closed
+	md := r.NewMatchData()
+	defer md.Close()
+	md.MatchString("abc")
+
+	r.Close()
+	if usage := budget.Usage(); usage != (pcre.BudgetUsage{}) {
+		t.Errorf("expected all resources to be released, got %+v", usage)
+	}
+}
+
+func TestBudgetMatchErr(t *testing.T) {
+	budget := &pcre.Budget{MaxMatchMemory: 1}
+
+	r, err := pcre.CompileWith(`(a)(b)?`, pcre.CompileConfig{Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// The match state can't be created within the budget
+	var be *pcre.BudgetError
+	if _, err := r.MatchStringErr("ab"); !errors.As(err, &be) || be.Resource != pcre.MatchMemory {
+		t.Errorf("expected match memory budget error, got %v", err)
+	}
+	if _, err := r.FindAllStringSubmatchIndexErr("abab", -1); !errors.As(err, &be) {
+		t.Errorf("expected match memory budget error, got %v", err)
+	}
+	if usage := budget.Usage(); usage.MatchMemory != 0 {
+		t.Errorf("expected no match memory to be used, got %d", usage.MatchMemory)
+	}
+}
+
+func TestBudgetFindEvery(t *testing.T) {
+	budget := &pcre.Budget{MaxMatchMemory: 16 * 1024}
+
+	r, err := pcre.CompileWith(`a+`, pcre.CompileConfig{
+		Options: pcre.NoAutoPossess,
+		Budget:  budget,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Create a match state, so that its allocations aren't counted
+	r.MatchString("a")
+
+	// The match data for every match at a start position is recorded
+	before := r.MemStats()
+	if got := r.FindEveryStringIndex("aaa", -1); len(got) != 6 {
+		t.Fatalf("expected 6 matches, got %v", got)
+	}
+	if after := r.MemStats(); after.TotalAlloc <= before.TotalAlloc || after.InUse != before.InUse {
+		t.Errorf("expected match data to be recorded and freed, got %+v before and %+v after", before, after)
+	}
+
+	// Storing thousands of matches needs more memory than the budget allows
+	defer func() {
+		var be *pcre.BudgetError
+		if err, _ := recover().(error); !errors.As(err, &be) || be.Resource != pcre.MatchMemory {
+			t.Errorf("expected match memory budget error, got %v", err)
+		}
+	}()
+	r.FindEveryStringIndex(strings.Repeat("a", 5000), -1)
+}
@@ -0,0 +1,275 @@
+package pcre
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// Cache holds compiled regular expressions, so that expressions
+// used repeatedly only need to be compiled once. The expressions
+// are shared between users of the cache, and are reused in least
+// recently used order.
+//
+// Expressions returned by Get are shared by every user that retrieves
+// the same pattern and config, so methods that change an expression,
+// such as Longest, SetCallout and the limit setters, affect all of its
+// users. Clone the expression to change it independently.
+//
+// Expressions returned by Get must be passed to Release once they're
+// no longer needed, rather than being closed. An expression is closed
+// once it has been evicted from the cache and released by all of its
+// users. The cache keeps a reference to expressions that haven't been
+// released, so the garbage collector doesn't close them while in use.
+//
+// A Cache is safe for concurrent use.
+type Cache struct {
+	mtx       sync.Mutex
+	size      int
+	entries   map[cacheKey]*cacheEntry
+	regexps   map[*Regexp]*cacheEntry
+	lru       *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// CacheStats contains statistics about the use of a Cache
+type CacheStats struct {
+	// Hits is the number of calls to Get that
+	// returned an expression from the cache
+	Hits uint64
+	// Misses is the number of calls to Get
+	// that needed to compile the expression
+	Misses uint64
+	// Evictions is the number of expressions
+	// removed to keep the size of the cache
+	Evictions uint64
+	// Len is the number of expressions in the cache
+	Len int
+}
+
+// cacheKey identifies an expression in a Cache. It contains the
+// settings of CompileConfig that affect the compiled expression.
+type cacheKey struct {
+	pattern string
+	options CompileOption
+	budget  *Budget
+	tables  *Tables
+	policy  UTFPolicy
+}
+
+// cacheEntry contains an expression in a Cache
+type cacheEntry struct {
+	key  cacheKey
+	elem *list.Element
+
+	// ready is closed once the expression is compiled,
+	// after which r or err is set.
+	ready chan struct{}
+	r     *Regexp
+	err   error
+
+	// refs is the number of users of the expression
+	refs int
+	// evicted is set once the entry is removed from the cache
+	evicted bool
+}
+
+// NewCache creates a cache that holds up to size expressions.
+// If size is zero or less, the number of expressions is not limited.
+func NewCache(size int) *Cache {
+	return &Cache{
+		size:    size,
+		entries: map[cacheKey]*cacheEntry{},
+		regexps: map[*Regexp]*cacheEntry{},
+		lru:     list.New(),
+	}
+}
+
+// Get returns the expression compiled from the given pattern
+// and options, compiling it using CompileOpts if it's not in
+// the cache.
+//
+// Release should be called on the returned expression
+// once it is no longer needed.
+func (c *Cache) Get(pattern string, options CompileOption) (*Regexp, error) {
+	return c.GetWith(pattern, CompileConfig{Options: options})
+}
+
+// GetWith returns the expression compiled from the given pattern
+// and config, compiling it using CompileWith if it's not in the cache.
+// The recursion guard and context of the config are only used when
+// compiling, so they aren't used to look up the expression.
+//
+// Release should be called on the returned expression
+// once it is no longer needed.
+func (c *Cache) GetWith(pattern string, config CompileConfig) (*Regexp, error) {
+	key := cacheKey{
+		pattern: pattern,
+		options: config.Options,
+		budget:  config.Budget,
+		tables:  config.Tables,
+		policy:  config.UTFPolicy,
+	}
+
+	c.mtx.Lock()
+	entry, ok := c.entries[key]
+	var closed []*Regexp
+	if ok && entry.r != nil && entry.r.closed() {
+		// The expression was closed by a user rather than released,
+		// so it's replaced with a newly compiled one.
+		closed = c.remove(entry, closed)
+		ok = false
+	}
+
+	if ok {
+		c.hits++
+		entry.refs++
+		c.lru.MoveToFront(entry.elem)
+		c.mtx.Unlock()
+		closeAll(closed)
+
+		// Wait for another user to finish compiling the expression
+		<-entry.ready
+		if entry.err != nil {
+			c.release(entry)
+			var guardErr *GuardError
+			if errors.As(entry.err, &guardErr) {
+				// Compilation was aborted by the other user's guard
+				// or context, so it's retried using this config.
+				return c.GetWith(pattern, config)
+			}
+			return nil, entry.err
+		}
+		return entry.r, nil
+	}
+
+	c.misses++
+	entry = &cacheEntry{key: key, ready: make(chan struct{}), refs: 1}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[key] = entry
+	c.mtx.Unlock()
+	closeAll(closed)
+
+	// Compile without holding the lock, so that other
+	// expressions can be retrieved in the meantime.
+	r, err := CompileWith(pattern, config)
+
+	c.mtx.Lock()
+	entry.r, entry.err = r, err
+	if err != nil {
+		// Failed compilations are not cached
+		closed = c.remove(entry, nil)
+	} else {
+		c.regexps[r] = entry
+		closed = c.evict()
+	}
+	c.mtx.Unlock()
+	close(entry.ready)
+	closeAll(closed)
+
+	if err != nil {
+		c.release(entry)
+		return nil, err
+	}
+	return r, nil
+}
+
+// Release returns an expression retrieved using Get or GetWith
+// to the cache. If the expression has been evicted from the cache
+// and has no other users, it's closed.
+func (c *Cache) Release(r *Regexp) {
+	c.mtx.Lock()
+	entry, ok := c.regexps[r]
+	c.mtx.Unlock()
+	if ok {
+		c.release(entry)
+	}
+}
+
+// Stats returns statistics about the use of the cache
+func (c *Cache) Stats() CacheStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Len:       len(c.entries),
+	}
+}
+
+// Purge removes all expressions from the cache. Expressions
+// that are in use are closed once they're released.
+func (c *Cache) Purge() {
+	c.mtx.Lock()
+	var closed []*Regexp
+	for _, entry := range c.entries {
+		closed = c.remove(entry, closed)
+	}
+	c.mtx.Unlock()
+
+	closeAll(closed)
+}
+
+// release removes a user from the entry, closing the
+// expression if it was evicted and has no other users.
+func (c *Cache) release(entry *cacheEntry) {
+	c.mtx.Lock()
+	if entry.refs == 0 {
+		// The expression was released more times than it was retrieved
+		c.mtx.Unlock()
+		return
+	}
+	entry.refs--
+	closeRegexp := entry.refs == 0 && entry.evicted
+	if closeRegexp && entry.r != nil {
+		delete(c.regexps, entry.r)
+	}
+	c.mtx.Unlock()
+
+	if closeRegexp {
+		entry.r.Close()
+	}
+}
+
+// evict removes the least recently used expressions
+// until the size of the cache is within its limit, and
+// returns the expressions that should be closed.
+// It must be called with c.mtx held.
+func (c *Cache) evict() []*Regexp {
+	var closed []*Regexp
+	for c.size > 0 && c.lru.Len() > c.size {
+		closed = c.remove(c.lru.Back().Value.(*cacheEntry), closed)
+		c.evictions++
+	}
+	return closed
+}
+
+// remove removes the entry from the cache, appending its expression
+// to closed if it has no users. It must be called with c.mtx held,
+// and the expressions must be closed once it's released, as closing
+// waits for running matches.
+func (c *Cache) remove(entry *cacheEntry, closed []*Regexp) []*Regexp {
+	if entry.evicted {
+		return closed
+	}
+	entry.evicted = true
+	c.lru.Remove(entry.elem)
+	delete(c.entries, entry.key)
+
+	if entry.refs == 0 && entry.r != nil {
+		delete(c.regexps, entry.r)
+		closed = append(closed, entry.r)
+	}
+	return closed
+}
+
+// closeAll closes the given expressions
+func closeAll(rs []*Regexp) {
+	for _, r := range rs {
+		r.Close()
+	}
+}
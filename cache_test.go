@@ -0,0 +1,208 @@
+package pcre_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.elara.ws/pcre"
+)
+
+func TestCache(t *testing.T) {
+	c := pcre.NewCache(2)
+	defer c.Purge()
+
+	r1, err := c.Get(`\d+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := c.Get(`\d+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r1 != r2 {
+		t.Error("expected the same expression to be returned")
+	}
+
+	// Different options are cached separately
+	r3, err := c.Get(`\d+`, pcre.UTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3 == r1 {
+		t.Error("expected different expressions for different options")
+	}
+
+	// Evicting an expression that's in use doesn't close it
+	r4, err := c.Get(`\w+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r1.MatchString("123") {
+		t.Error("expected evicted expression in use to match")
+	}
+
+	expected := pcre.CacheStats{Hits: 1, Misses: 3, Evictions: 1, Len: 2}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("expected %+v, got %+v", expected, stats)
+	}
+
+	// The evicted expression is closed once all users release it
+	c.Release(r1)
+	if !r1.MatchString("123") {
+		t.Error("expected evicted expression in use to match")
+	}
+	c.Release(r2)
+	if err := r1.SetMatchLimit(1); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected released expression to be closed, got %v", err)
+	}
+
+	// Expressions in the cache stay open once released
+	c.Release(r3)
+	c.Release(r4)
+	if !r4.MatchString("abc") {
+		t.Error("expected cached expression to match")
+	}
+
+	// Compile errors aren't cached
+	if _, err := c.Get(`(`, 0); err == nil {
+		t.Error("expected compile error")
+	}
+	if stats := c.Stats(); stats.Len != 2 {
+		t.Errorf("expected 2 cached expressions, got %d", stats.Len)
+	}
+
+	// Closed expressions are compiled again
+	r4.Close()
+	r5, err := c.Get(`\w+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r5.MatchString("abc") {
+		t.Error("expected recompiled expression to match")
+	}
+	c.Release(r5)
+
+	c.Purge()
+	if err := r5.SetMatchLimit(1); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected purged expression to be closed, got %v", err)
+	}
+}
+
+func TestCacheConcurrency(t *testing.T) {
+	c := pcre.NewCache(4)
+	defer c.Purge()
+
+	patterns := []string{`a+`, `b+`, `c+`, `d+`, `e+`, `f+`}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				pattern := patterns[(i+j)%len(patterns)]
+				r, err := c.Get(pattern, 0)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !r.MatchString(pattern[:1]) {
+					t.Errorf("expected %s to match", pattern)
+				}
+				c.Release(r)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Hits+stats.Misses != 16*200 {
+		t.Errorf("expected %d lookups, got %d", 16*200, stats.Hits+stats.Misses)
+	}
+	if stats.Len > 4 {
+		t.Errorf("expected at most 4 cached expressions, got %d", stats.Len)
+	}
+}
+
+func TestCachePurgeWhileMatching(t *testing.T) {
+	c := pcre.NewCache(0)
+
+	r, err := c.Get(`a(?C1)`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	err = r.SetCallout(func(*pcre.CalloutBlock) int32 {
+		close(started)
+		<-finish
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A match that outlives its user's reference
+	matched := make(chan bool)
+	go func() {
+		matched <- r.MatchString("a")
+	}()
+	<-started
+	c.Release(r)
+
+	// Purging closes the expression, which waits for the match,
+	// but the cache stays usable in the meantime.
+	purged := make(chan struct{})
+	go func() {
+		c.Purge()
+		close(purged)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		// Wait for the expression to be removed
+		for c.Stats().Len != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		other, err := c.Get(`b`, 0)
+		if err == nil {
+			c.Release(other)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected cache not to be locked while closing an expression")
+	}
+
+	close(finish)
+	if !<-matched {
+		t.Error("expected match to succeed")
+	}
+	<-purged
+	c.Purge()
+}
+
+func BenchmarkCache(b *testing.B) {
+	c := pcre.NewCache(16)
+	defer c.Purge()
+
+	const expr = `(?<year>\d{4})-(?<month>\d{2})-(?<day>\d{2})`
+
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r, _ := c.Get(expr, 0)
+			c.Release(r)
+		}
+	})
+
+	b.Run("Compile", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pcre.MustCompile(expr).Close()
+		}
+	})
+}
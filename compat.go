@@ -0,0 +1,331 @@
+package pcre
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre/syntax"
+)
+
+// Match reports whether the byte slice b contains any match
+// of the regular expression pattern. More complicated queries
+// need to use Compile and the full Regexp interface.
+func Match(pattern string, b []byte) (matched bool, err error) {
+	r, err := Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return r.Match(b), nil
+}
+
+// MatchString is the String version of Match
+func MatchString(pattern string, s string) (matched bool, err error) {
+	return Match(pattern, []byte(s))
+}
+
+// MatchReader is the io.RuneReader version of Match
+func MatchReader(pattern string, rr io.RuneReader) (matched bool, err error) {
+	return Match(pattern, readRunes(rr))
+}
+
+// QuoteMeta returns a string that escapes all regular expression
+// metacharacters inside the argument text; the returned string
+// is a regular expression matching the literal text.
+func QuoteMeta(s string) string {
+	return regexp.QuoteMeta(s)
+}
+
+// Longest makes future searches prefer leftmost-longest matches.
+// That is, when matching against text, the regexp returns a match
+// that begins as early as possible in the input (leftmost), and among
+// those it chooses a match that is as long as possible.
+//
+// Matches are found using pcre2's DFA algorithm. If the pattern uses
+// features the DFA algorithm doesn't support, such as backreferences,
+// or was compiled with the MatchInvalidUTF option, matching falls back
+// to leftmost-first semantics. Submatches are found by matching again
+// within the longest match, so they are unset if the match depends on
+// the text following it, such as with a lookahead.
+//
+// This method modifies the Regexp and may not be called concurrently
+// with any other methods.
+func (r *Regexp) Longest() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.longest = true
+}
+
+// LiteralPrefix returns a literal string that must begin any match
+// of the regular expression re. It returns the boolean true if the
+// literal string comprises the entire regular expression.
+func (r *Regexp) LiteralPrefix() (prefix string, complete bool) {
+	if err := r.acquire(); err != nil {
+		panic(err)
+	}
+	defer r.release()
+
+	tree, err := syntax.Parse(r.expr, syntax.Flags(r.opts))
+	if err != nil {
+		return "", false
+	}
+
+	subs := []*syntax.Node{tree}
+	if tree.Op == syntax.OpConcat {
+		subs = tree.Sub
+	}
+
+	// A leading anchor doesn't prevent a prefix,
+	// but the prefix is no longer the entire expression.
+	complete = true
+	if first := subs[0]; first.Op == syntax.OpAssertion && first.Flags&syntax.Multiline == 0 {
+		if first.Text == "^" || first.Text == `\A` {
+			subs = subs[1:]
+			complete = false
+		}
+	}
+
+	var buf []byte
+	utf := r.opts&UTF != 0
+	for _, n := range subs {
+		if !literalPrefix(&buf, n, utf) {
+			return string(buf), false
+		}
+	}
+	return string(buf), complete
+}
+
+// literalPrefix appends the literal text that must begin any match
+// of n to buf. It returns true if n matches only that literal text,
+// in which case the prefix may continue with the following node.
+func literalPrefix(buf *[]byte, n *syntax.Node, utf bool) bool {
+	switch n.Op {
+	case syntax.OpEmpty, syntax.OpOptions:
+		return true
+	case syntax.OpLiteral:
+		if n.Flags&syntax.Caseless != 0 && unicode.SimpleFold(n.Rune) != n.Rune {
+			return false
+		}
+		if utf {
+			*buf = utf8.AppendRune(*buf, n.Rune)
+		} else {
+			*buf = append(*buf, byte(n.Rune))
+		}
+		return true
+	case syntax.OpConcat:
+		for _, sub := range n.Sub {
+			if !literalPrefix(buf, sub, utf) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpGroup:
+		switch n.Group {
+		case syntax.GroupCapture, syntax.GroupNonCapture, syntax.GroupAtomic:
+			return literalPrefix(buf, n.Sub[0], utf)
+		}
+	case syntax.OpRepeat:
+		if n.Min > 0 {
+			literalPrefix(buf, n.Sub[0], utf)
+		}
+	}
+	return false
+}
+
+// Expand appends template to dst and returns the result; during the
+// append, Expand replaces variables in the template with corresponding
+// matches drawn from src. The match slice should have been returned by
+// FindSubmatchIndex.
+//
+// In the template, a variable is denoted by a substring of the form
+// $name or ${name}, where name is a non-empty sequence of letters,
+// digits, and underscores. A purely numeric name like $1 refers to
+// the submatch with the corresponding index; other names refer to
+// capturing parentheses named with the (?P<name>...) syntax. A
+// reference to an out of range or unmatched index or a name that is not
+// present in the regular expression is replaced with an empty slice.
+//
+// In the $name form, name is taken to be as long as possible: $1x is
+// equivalent to ${1x}, not ${1}x, and, $10 is equivalent to ${10}, not ${1}0.
+//
+// To insert a literal $ in the output, use $$ in the template.
+func (r *Regexp) Expand(dst []byte, template []byte, src []byte, match []int) []byte {
+	return expand(dst, string(template), src, "", match, r.SubexpNames())
+}
+
+// ExpandString is like Expand but the template and source are strings.
+// It appends to and returns a byte slice in order to give the calling
+// code control over allocation.
+func (r *Regexp) ExpandString(dst []byte, template string, src string, match []int) []byte {
+	return expand(dst, template, nil, src, match, r.SubexpNames())
+}
+
+// expand implements Expand and ExpandString. The source is
+// bsrc if it is not nil, or src otherwise.
+func expand(dst []byte, template string, bsrc []byte, src string, match []int, names []string) []byte {
+	for len(template) > 0 {
+		before, after, ok := strings.Cut(template, "$")
+		if !ok {
+			break
+		}
+		dst = append(dst, before...)
+		template = after
+
+		// $$ is a literal dollar sign
+		if template != "" && template[0] == '$' {
+			dst = append(dst, '$')
+			template = template[1:]
+			continue
+		}
+
+		name, num, rest, ok := extractVar(template)
+		if !ok {
+			// Malformed variables are copied as-is
+			dst = append(dst, '$')
+			continue
+		}
+		template = rest
+
+		index := num
+		if num < 0 {
+			// Use the first group with the name that participated in the match
+			for i, groupName := range names {
+				if name == groupName && 2*i+1 < len(match) && match[2*i] >= 0 {
+					index = i
+					break
+				}
+			}
+		}
+
+		if index >= 0 && 2*index+1 < len(match) && match[2*index] >= 0 {
+			if bsrc != nil {
+				dst = append(dst, bsrc[match[2*index]:match[2*index+1]]...)
+			} else {
+				dst = append(dst, src[match[2*index]:match[2*index+1]]...)
+			}
+		}
+	}
+	return append(dst, template...)
+}
+
+// extractVar returns the name from a leading $name or ${name}
+// in str, without the dollar sign. If the name is a number,
+// num is set to it. Otherwise, num is -1.
+func extractVar(str string) (name string, num int, rest string, ok bool) {
+	if str == "" {
+		return "", 0, "", false
+	}
+
+	brace := false
+	if str[0] == '{' {
+		brace = true
+		str = str[1:]
+	}
+
+	i := 0
+	for i < len(str) {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			break
+		}
+		i += size
+	}
+	if i == 0 {
+		return "", 0, "", false
+	}
+	name = str[:i]
+
+	if brace {
+		if i >= len(str) || str[i] != '}' {
+			return "", 0, "", false
+		}
+		i++
+	}
+
+	// Numbers with leading zeros are treated as names
+	num = 0
+	for j := 0; j < len(name); j++ {
+		if name[j] < '0' || name[j] > '9' || num >= 1e8 {
+			num = -1
+			break
+		}
+		num = num*10 + int(name[j]-'0')
+	}
+	if name[0] == '0' && len(name) > 1 {
+		num = -1
+	}
+
+	return name, num, str[i:], true
+}
+
+// MatchReader reports whether the text returned by the RuneReader
+// contains any match of the regular expression.
+//
+// Unlike Go's regexp package, the whole input is read before matching,
+// as pcre2 can't match text incrementally.
+func (r *Regexp) MatchReader(rr io.RuneReader) bool {
+	return r.Match(readRunes(rr))
+}
+
+// FindReaderIndex returns a two-element slice of integers defining the
+// location of the leftmost match of the regular expression in text read
+// from the RuneReader. The match text was found in the input stream at
+// byte offset loc[0] through loc[1]-1. A return value of nil indicates
+// no match.
+func (r *Regexp) FindReaderIndex(rr io.RuneReader) (loc []int) {
+	return r.FindIndex(readRunes(rr))
+}
+
+// FindReaderSubmatchIndex returns a slice holding the index pairs
+// identifying the leftmost match of the regular expression of text
+// read by the RuneReader, and the matches, if any, of its subexpressions.
+// A return value of nil indicates no match.
+func (r *Regexp) FindReaderSubmatchIndex(rr io.RuneReader) []int {
+	return r.FindSubmatchIndex(readRunes(rr))
+}
+
+// readRunes reads runes from rr until it returns an error,
+// and returns their UTF-8 encoding.
+func readRunes(rr io.RuneReader) []byte {
+	var b []byte
+	for {
+		r, _, err := rr.ReadRune()
+		if err != nil {
+			return b
+		}
+		b = utf8.AppendRune(b, r)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler. The output
+// matches that of calling the String method.
+//
+// Compile options are not included in the output.
+func (r *Regexp) MarshalText() ([]byte, error) {
+	return []byte(r.expr), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler by compiling
+// the encoded value, using the options, tables and UTF policy r was
+// compiled with, if any. If r was already compiled, it is closed first.
+func (r *Regexp) UnmarshalText(text []byte) error {
+	nr, err := CompileWith(string(text), CompileConfig{
+		Options:   r.opts,
+		Tables:    r.config.Tables,
+		UTFPolicy: r.utfPolicy,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.Close()
+	*r = *nr
+	// nr keeps ownership of the resources, so that r doesn't need a
+	// finalizer of its own, which would not be allowed if r was a
+	// field in another struct.
+	r.owner = nr
+	return nil
+}
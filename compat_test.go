@@ -0,0 +1,203 @@
+package pcre_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+var compatTests = []struct {
+	pattern  string
+	subjects []string
+}{
+	{`a+`, []string{"baaab", "xyz", "aa a"}},
+	{`(\w+)@(\w+)\.com`, []string{"a@b.com, cd@ef.com", "none"}},
+	{`(?P<key>[a-z]+)=(?P<value>\d+)?`, []string{"a=1 b= c=33"}},
+	{`x(a|b)?y`, []string{"xy xay xby"}},
+	{`(?i)hello`, []string{"HeLLo hello"}},
+	{`\d{2,3}`, []string{"1 12 1234 12345"}},
+	{`[^,]+`, []string{"a,b,,c"}},
+	{`(a)|(b)`, []string{"ab"}},
+}
+
+func TestCompat(t *testing.T) {
+	for _, test := range compatTests {
+		r := pcre.MustCompile(test.pattern)
+		std := regexp.MustCompile(test.pattern)
+
+		check := func(method string, got, expected any) {
+			t.Helper()
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s.%s: expected %q, got %q", test.pattern, method, expected, got)
+			}
+		}
+
+		check("NumSubexp", r.NumSubexp(), std.NumSubexp())
+		check("SubexpNames", r.SubexpNames(), std.SubexpNames())
+
+		for _, s := range test.subjects {
+			b := []byte(s)
+			check("FindString", r.FindString(s), std.FindString(s))
+			check("FindIndex", r.FindIndex(b), std.FindIndex(b))
+			check("FindStringSubmatch", r.FindStringSubmatch(s), std.FindStringSubmatch(s))
+			check("FindAllString", r.FindAllString(s, -1), std.FindAllString(s, -1))
+			check("FindAllStringSubmatchIndex", r.FindAllStringSubmatchIndex(s, -1), std.FindAllStringSubmatchIndex(s, -1))
+			check("FindAllIndex", r.FindAllIndex(b, 2), std.FindAllIndex(b, 2))
+			check("MatchString", r.MatchString(s), std.MatchString(s))
+			check("MatchReader", r.MatchReader(strings.NewReader(s)), std.MatchReader(strings.NewReader(s)))
+			check("FindReaderIndex", r.FindReaderIndex(strings.NewReader(s)), std.FindReaderIndex(strings.NewReader(s)))
+			check("FindReaderSubmatchIndex", r.FindReaderSubmatchIndex(strings.NewReader(s)), std.FindReaderSubmatchIndex(strings.NewReader(s)))
+
+			for _, repl := range []string{"<$0>", "$1-$2", "${1}x$1x", "$$", "$key=${value}", "$", "${1"} {
+				check("ReplaceAllString("+repl+")", r.ReplaceAllString(s, repl), std.ReplaceAllString(s, repl))
+			}
+			check("ReplaceAllLiteralString", r.ReplaceAllLiteralString(s, "$1"), std.ReplaceAllLiteralString(s, "$1"))
+
+			match := std.FindStringSubmatchIndex(s)
+			check("ExpandString", r.ExpandString(nil, "[$1|$0]", s, match), std.ExpandString(nil, "[$1|$0]", s, match))
+			check("Expand", r.Expand([]byte("x"), []byte("$2$1"), b, match), std.Expand([]byte("x"), []byte("$2$1"), b, match))
+		}
+
+		r.Close()
+	}
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	patterns := []string{"abc", "abc+", "(abc)", "^abc", "(?i)abc", "a|b", "ab(c|d)", "", "a.c", `\.x`, "x*", "(?:ab)c", `ab\b`}
+	for _, pattern := range patterns {
+		r := pcre.MustCompile(pattern)
+		prefix, complete := r.LiteralPrefix()
+		expectedPrefix, expectedComplete := regexp.MustCompile(pattern).LiteralPrefix()
+		if prefix != expectedPrefix || complete != expectedComplete {
+			t.Errorf("%s: expected (%q, %t), got (%q, %t)", pattern, expectedPrefix, expectedComplete, prefix, complete)
+		}
+		r.Close()
+	}
+}
+
+func TestLongest(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+	}{
+		{`a|ab`, "xab"},
+		{`a(b|bc)`, "abcd abd"},
+		{`(a+?)(b*)`, "aab"},
+		{`x*`, "xxx"},
+	}
+
+	for _, test := range tests {
+		r := pcre.MustCompile(test.pattern)
+		r.Longest()
+		std := regexp.MustCompile(test.pattern)
+		std.Longest()
+
+		expected := std.FindStringSubmatchIndex(test.subject)
+		got := r.FindStringSubmatchIndex(test.subject)
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", test.pattern, expected, got)
+		}
+		r.Close()
+	}
+
+	// The submatches can't be recovered if the match depends on
+	// the text that follows it, but the match itself is still found.
+	r := pcre.MustCompile(`(a|ab)(?=c)`)
+	r.Longest()
+	defer r.Close()
+
+	expected := []int{0, 2, -1, -1}
+	if got := r.FindStringSubmatchIndex("abc"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// The DFA algorithm doesn't support MatchInvalidUTF,
+	// so matching falls back to leftmost-first semantics.
+	r2 := pcre.MustCompileOpts(`é|éa`, pcre.MatchInvalidUTF)
+	r2.Longest()
+	defer r2.Close()
+
+	expected = []int{2, 4}
+	if got := r2.FindStringIndex("\xffxéa"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPackageMatch(t *testing.T) {
+	matched, err := pcre.MatchString(`\d+(?= USD)`, "9000 USD")
+	if err != nil || !matched {
+		t.Errorf("expected match, got %t (%v)", matched, err)
+	}
+
+	matched, err = pcre.Match(`x`, []byte("abc"))
+	if err != nil || matched {
+		t.Errorf("expected no match, got %t (%v)", matched, err)
+	}
+
+	matched, err = pcre.MatchReader(`b+`, strings.NewReader("abbc"))
+	if err != nil || !matched {
+		t.Errorf("expected match, got %t (%v)", matched, err)
+	}
+
+	_, err = pcre.MatchString(`(`, "")
+	if err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+
+	s := `1.5+[a]{2}(x)|y^$\`
+	quoted := pcre.QuoteMeta(s)
+	r := pcre.MustCompile("^" + quoted + "$")
+	defer r.Close()
+	if !r.MatchString(s) {
+		t.Errorf("%s did not match %s", quoted, s)
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	type config struct {
+		Ptr   *pcre.Regexp
+		Value pcre.Regexp
+	}
+
+	var cfg config
+	err := json.Unmarshal([]byte(`{"Ptr": "a+(?=b)", "Value": "\\d+"}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Ptr.FindString("caab") != "aa" {
+		t.Errorf("expected aa, got %q", cfg.Ptr.FindString("caab"))
+	}
+	if cfg.Value.FindString("x42") != "42" {
+		t.Errorf("expected 42, got %q", cfg.Value.FindString("x42"))
+	}
+
+	out, err := json.Marshal(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, []byte(`{"Ptr":"a+(?=b)","Value":"\\d+"}`)) {
+		t.Errorf("unexpected output: %s", out)
+	}
+
+	// Unmarshaling again replaces the expression
+	if err := cfg.Ptr.UnmarshalText([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Ptr.String() != "b" || !cfg.Ptr.MatchString("abc") {
+		t.Errorf("expression was not replaced: %s", cfg.Ptr)
+	}
+
+	if err := cfg.Value.UnmarshalText([]byte("(")); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+
+	cfg.Ptr.Close()
+	cfg.Value.Close()
+	cfg.Value.Close()
+}
@@ -0,0 +1,159 @@
+package pcre
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+
+	"modernc.org/libc"
+)
+
+// Newline represents the character sequences recognized as newlines
+type Newline uint32
+
+const (
+	NewlineCR      = Newline(lib.DPCRE2_NEWLINE_CR)
+	NewlineLF      = Newline(lib.DPCRE2_NEWLINE_LF)
+	NewlineCRLF    = Newline(lib.DPCRE2_NEWLINE_CRLF)
+	NewlineAny     = Newline(lib.DPCRE2_NEWLINE_ANY)
+	NewlineAnyCRLF = Newline(lib.DPCRE2_NEWLINE_ANYCRLF)
+	NewlineNUL     = Newline(lib.DPCRE2_NEWLINE_NUL)
+)
+
+// String returns the name of the newline convention,
+// as used in a (*...) pattern start item.
+func (n Newline) String() string {
+	switch n {
+	case NewlineCR:
+		return "CR"
+	case NewlineLF:
+		return "LF"
+	case NewlineCRLF:
+		return "CRLF"
+	case NewlineAny:
+		return "ANY"
+	case NewlineAnyCRLF:
+		return "ANYCRLF"
+	case NewlineNUL:
+		return "NUL"
+	default:
+		return fmt.Sprintf("Newline(%d)", uint32(n))
+	}
+}
+
+// BSR represents the character sequences matched by \R
+type BSR uint32
+
+const (
+	// BSRUnicode makes \R match any Unicode line ending
+	BSRUnicode = BSR(lib.DPCRE2_BSR_UNICODE)
+	// BSRAnyCRLF makes \R match only CR, LF, or CRLF
+	BSRAnyCRLF = BSR(lib.DPCRE2_BSR_ANYCRLF)
+)
+
+// String returns the name of the \R convention,
+// as used in a (*...) pattern start item.
+func (b BSR) String() string {
+	switch b {
+	case BSRUnicode:
+		return "BSR_UNICODE"
+	case BSRAnyCRLF:
+		return "BSR_ANYCRLF"
+	default:
+		return fmt.Sprintf("BSR(%d)", uint32(b))
+	}
+}
+
+// BuildConfig describes how the embedded pcre2 library was built
+type BuildConfig struct {
+	// Version is the version and release date of pcre2
+	Version string
+
+	// Unicode reports whether Unicode support is available
+	Unicode bool
+	// UnicodeVersion is the version of the Unicode
+	// tables, or empty if Unicode isn't supported.
+	UnicodeVersion string
+
+	// JIT reports whether JIT compilation is available
+	JIT bool
+	// JITTarget describes the architecture targeted by
+	// the JIT compiler, or is empty if JIT isn't available.
+	JITTarget string
+
+	// Newline is the default newline convention
+	Newline Newline
+	// BSR is the default set of sequences matched by \R
+	BSR BSR
+
+	// LinkSize is the number of bytes used for
+	// internal links in compiled code.
+	LinkSize int
+
+	// MatchLimit is the default match limit
+	MatchLimit uint32
+	// DepthLimit is the default depth limit
+	DepthLimit uint32
+	// HeapLimit is the default heap limit, in kibibytes
+	HeapLimit uint32
+	// ParensLimit is the maximum nesting depth
+	// of parentheses in a pattern.
+	ParensLimit uint32
+
+	// NeverBackslashC reports whether \C is always
+	// disallowed in patterns.
+	NeverBackslashC bool
+}
+
+var (
+	buildConfig     BuildConfig
+	buildConfigOnce sync.Once
+)
+
+// Config returns the build configuration of the embedded
+// pcre2 library, which may differ between platforms.
+func Config() BuildConfig {
+	buildConfigOnce.Do(func() {
+		tls := libc.NewTLS()
+		defer tls.Close()
+
+		buildConfig = BuildConfig{
+			Version:         configString(tls, lib.DPCRE2_CONFIG_VERSION),
+			Unicode:         configInt(tls, lib.DPCRE2_CONFIG_UNICODE) != 0,
+			UnicodeVersion:  configString(tls, lib.DPCRE2_CONFIG_UNICODE_VERSION),
+			JIT:             configInt(tls, lib.DPCRE2_CONFIG_JIT) != 0,
+			JITTarget:       configString(tls, lib.DPCRE2_CONFIG_JITTARGET),
+			Newline:         Newline(configInt(tls, lib.DPCRE2_CONFIG_NEWLINE)),
+			BSR:             BSR(configInt(tls, lib.DPCRE2_CONFIG_BSR)),
+			LinkSize:        int(configInt(tls, lib.DPCRE2_CONFIG_LINKSIZE)),
+			MatchLimit:      configInt(tls, lib.DPCRE2_CONFIG_MATCHLIMIT),
+			DepthLimit:      configInt(tls, lib.DPCRE2_CONFIG_DEPTHLIMIT),
+			HeapLimit:       configInt(tls, lib.DPCRE2_CONFIG_HEAPLIMIT),
+			ParensLimit:     configInt(tls, lib.DPCRE2_CONFIG_PARENSLIMIT),
+			NeverBackslashC: configInt(tls, lib.DPCRE2_CONFIG_NEVER_BACKSLASH_C) != 0,
+		}
+	})
+	return buildConfig
+}
+
+// configInt returns an integer from pcre2_config
+func configInt(tls *libc.TLS, what uint32) (out uint32) {
+	lib.Xpcre2_config_8(tls, what, uintptr(unsafe.Pointer(&out)))
+	return
+}
+
+// configString returns a string from pcre2_config,
+// or an empty string if it's not available.
+func configString(tls *libc.TLS, what uint32) string {
+	// Get the length of the string, including the terminating NUL
+	length := lib.Xpcre2_config_8(tls, what, 0)
+	if length <= 0 {
+		return ""
+	}
+
+	buf := make([]byte, length)
+	lib.Xpcre2_config_8(tls, what, uintptr(unsafe.Pointer(&buf[0])))
+	return string(buf[:length-1])
+}
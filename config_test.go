@@ -0,0 +1,34 @@
+package pcre_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestConfig(t *testing.T) {
+	cfg := pcre.Config()
+
+	if !strings.HasPrefix(cfg.Version, pcre.Version()+" ") {
+		t.Errorf("expected version to start with %q, got %q", pcre.Version(), cfg.Version)
+	}
+	if !cfg.Unicode || cfg.UnicodeVersion == "" {
+		t.Errorf("expected Unicode support, got %v %q", cfg.Unicode, cfg.UnicodeVersion)
+	}
+	if cfg.JIT || cfg.JITTarget != "" {
+		t.Errorf("expected no JIT, got %v %q", cfg.JIT, cfg.JITTarget)
+	}
+	if cfg.Newline != pcre.NewlineLF || cfg.Newline.String() != "LF" {
+		t.Errorf("expected LF newline, got %v", cfg.Newline)
+	}
+	if cfg.BSR != pcre.BSRUnicode {
+		t.Errorf("expected Unicode BSR, got %v", cfg.BSR)
+	}
+	if cfg.LinkSize != 2 {
+		t.Errorf("expected link size 2, got %d", cfg.LinkSize)
+	}
+	if cfg.MatchLimit == 0 || cfg.DepthLimit == 0 || cfg.HeapLimit == 0 || cfg.ParensLimit == 0 {
+		t.Errorf("expected default limits to be set, got %+v", cfg)
+	}
+}
@@ -0,0 +1,598 @@
+package pcre_test
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre"
+)
+
+// re2Options makes pcre2 follow RE2's semantics for ^ and $
+const re2Options = pcre.UTF | pcre.MatchInvalidUTF | pcre.DollarEndOnly | pcre.AltCircumflex
+
+// TestRE2Search runs the search tests from Go's regexp package,
+// which were generated using RE2, against this package.
+func TestRE2Search(t *testing.T) {
+	path := filepath.Join(runtime.GOROOT(), "src", "regexp", "testdata", "re2-search.txt")
+	f, err := os.Open(path)
+	if err != nil {
+		t.Skipf("RE2 test data not available: %s", err)
+	}
+	defer f.Close()
+
+	var (
+		strs      []string
+		input     []string
+		inStrings bool
+		re        *pcre.Regexp
+		refull    *pcre.Regexp
+		longest   [2]*pcre.Regexp
+		std       *regexp.Regexp
+		ncase     int
+		nskip     int
+		nfail     int
+	)
+
+	closeAll := func() {
+		re.Close()
+		refull.Close()
+		longest[0].Close()
+		longest[1].Close()
+		re, refull, longest = nil, nil, [2]*pcre.Regexp{}
+	}
+	defer closeAll()
+
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		switch {
+		case line == "" || line[0] == '#' || 'A' <= line[0] && line[0] <= 'Z':
+			continue
+		case line == "strings":
+			strs = strs[:0]
+			inStrings = true
+		case line == "regexps":
+			inStrings = false
+		case line[0] == '"':
+			q, err := strconv.Unquote(line)
+			if err != nil {
+				t.Fatalf("%s:%d: unquote %s: %v", path, lineno, line, err)
+			}
+			if inStrings {
+				strs = append(strs, q)
+				continue
+			}
+
+			closeAll()
+			input = strs
+			if !re2Compatible(q) {
+				continue
+			}
+
+			re, err = pcre.CompileOpts(q, re2Options)
+			if err != nil {
+				t.Errorf("%s:%d: compile %#q: %v", path, lineno, q, err)
+				continue
+			}
+			refull = pcre.MustCompileOpts(`\A(?:`+q+`)\z`, re2Options)
+			std = regexp.MustCompile(q)
+
+			// The DFA algorithm used for leftmost-longest matching
+			// doesn't support MatchInvalidUTF, so matching would
+			// fall back to leftmost-first semantics.
+			longest[0] = pcre.MustCompileOpts(`\A(?:`+q+`)\z`, re2Options&^pcre.MatchInvalidUTF)
+			longest[0].Longest()
+			longest[1] = pcre.MustCompileOpts(q, re2Options&^pcre.MatchInvalidUTF)
+			longest[1].Longest()
+		case line[0] == '-' || '0' <= line[0] && line[0] <= '9':
+			if len(input) == 0 {
+				t.Fatalf("%s:%d: out of sync: no input remaining", path, lineno)
+			}
+			var text string
+			text, input = input[0], input[1:]
+
+			ncase++
+			if re == nil {
+				nskip++
+				continue
+			}
+
+			// For leftmost-longest matching, only the overall match is
+			// compared, as submatches follow POSIX rules, which pcre2
+			// doesn't implement.
+			res := strings.Split(line, ";")
+			for i, r := range []*pcre.Regexp{refull, re, longest[0], longest[1]} {
+				if i >= 2 && !utf8.ValidString(text) {
+					continue
+				}
+
+				want := parseRE2Result(t, path, lineno, res[i])
+				have := r.FindStringSubmatchIndex(text)
+				if i >= 2 && want != nil && have != nil {
+					want, have = want[:2], have[:2]
+				}
+				if !reflect.DeepEqual(have, want) {
+					t.Errorf("%s:%d: %#q.FindStringSubmatchIndex(%#q) = %v, want %v", path, lineno, r, text, have, want)
+					if nfail++; nfail >= 100 {
+						t.Fatalf("stopping after %d errors", nfail)
+					}
+				}
+			}
+
+			// The corpus only contains the first match, so the iteration
+			// over all matches is compared with Go's regexp package.
+			if !compareAll(t, re, std, text) {
+				if nfail++; nfail >= 100 {
+					t.Fatalf("stopping after %d errors", nfail)
+				}
+			}
+		default:
+			t.Fatalf("%s:%d: out of sync: %s", path, lineno, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%d cases tested, %d skipped", ncase-nskip, nskip)
+}
+
+// compareAll compares the methods that iterate over all matches
+// between r and std, reporting whether they returned the same results.
+func compareAll(t *testing.T, r *pcre.Regexp, std *regexp.Regexp, text string) bool {
+	t.Helper()
+
+	ok := true
+	check := func(method string, have, want any) {
+		t.Helper()
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%#q.%s(%#q) = %q, want %q", r, method, text, have, want)
+			ok = false
+		}
+	}
+
+	check("FindAllStringSubmatchIndex", r.FindAllStringSubmatchIndex(text, -1), std.FindAllStringSubmatchIndex(text, -1))
+	check("Split", r.Split(text, -1), std.Split(text, -1))
+	check("ReplaceAllString", r.ReplaceAllString(text, "<$0>"), std.ReplaceAllString(text, "<$0>"))
+	check("ReplaceAllLiteralString", r.ReplaceAllLiteralString(text, "-"), std.ReplaceAllLiteralString(text, "-"))
+	return ok
+}
+
+// re2Compatible reports whether the RE2 pattern has the same
+// meaning in pcre2, so its results can be compared.
+func re2Compatible(pattern string) bool {
+	// RE2's \C matches a single byte, which is
+	// not supported with MatchInvalidUTF.
+	return !strings.Contains(pattern, `\C`)
+}
+
+// parseRE2Result parses a result from an RE2 test
+// file into the format used by FindSubmatchIndex.
+func parseRE2Result(t *testing.T, path string, lineno int, res string) []int {
+	// A single - indicates no match
+	if res == "-" {
+		return nil
+	}
+
+	var out []int
+	for _, pair := range strings.Split(res, " ") {
+		// - means that the group didn't participate in the match
+		if pair == "-" {
+			out = append(out, -1, -1)
+			continue
+		}
+
+		lo, hi, _ := strings.Cut(pair, "-")
+		start, err1 := strconv.Atoi(lo)
+		end, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil {
+			t.Fatalf("%s:%d: invalid pair %s", path, lineno, pair)
+		}
+		out = append(out, start, end)
+	}
+	return out
+}
+
+// pcre2Modifiers maps the pattern modifiers of pcre2test
+// supported by the conformance harness to compile options.
+var pcre2Modifiers = map[string]pcre.CompileOption{
+	"i":                   pcre.Caseless,
+	"m":                   pcre.Multiline,
+	"s":                   pcre.DotAll,
+	"x":                   pcre.Extended,
+	"n":                   pcre.NoAutoCapture,
+	"caseless":            pcre.Caseless,
+	"multiline":           pcre.Multiline,
+	"dotall":              pcre.DotAll,
+	"extended":            pcre.Extended,
+	"no_auto_capture":     pcre.NoAutoCapture,
+	"allow_empty_class":   pcre.AllowEmptyClass,
+	"alt_bsux":            pcre.AltBsux,
+	"alt_circumflex":      pcre.AltCircumflex,
+	"anchored":            pcre.Anchored,
+	"dollar_endonly":      pcre.DollarEndOnly,
+	"dupnames":            pcre.DupNames,
+	"endanchored":         pcre.EndAnchored,
+	"firstline":           pcre.FirstLine,
+	"literal":             pcre.Literal,
+	"match_unset_backref": pcre.MatchUnsetBackref,
+	"no_auto_possess":     pcre.NoAutoPossess,
+	"no_dotstar_anchor":   pcre.NoDotStarAnchor,
+	"no_start_optimize":   pcre.NoStartOptimize,
+	"ucp":                 pcre.UCP,
+	"ungreedy":            pcre.Ungreedy,
+	"utf":                 pcre.UTF,
+}
+
+// TestPCRE2Output runs every pcre2test output file in the testdata
+// directory, which contains a small sample. The output files from
+// pcre2's source distribution, covered by LICENSE-PCRE2, are run by
+// default once they're added there. Output files in another directory,
+// such as the testdata directory of pcre2's source code, are also run
+// if the PCRE2_TESTDATA environment variable is set to it, in which
+// case missing output files are a failure.
+func TestPCRE2Output(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "testoutput*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dir := os.Getenv("PCRE2_TESTDATA"); dir != "" {
+		extra, err := filepath.Glob(filepath.Join(dir, "testoutput*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(extra) == 0 {
+			t.Fatalf("no pcre2test output files in PCRE2_TESTDATA (%s)", dir)
+		}
+		paths = append(paths, extra...)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			runPCRE2Output(t, path)
+		})
+	}
+}
+
+// pcre2Subject contains a subject from a pcre2test
+// output file along with its expected results.
+type pcre2Subject struct {
+	lineno  int
+	subject []byte
+	results []string
+	noMatch bool
+	skip    bool
+}
+
+// runPCRE2Output runs the patterns and subjects in a pcre2test output file,
+// comparing the first match of each subject. Patterns and subjects using
+// pcre2test features that can't be reproduced with this package, such as
+// global matching or subject modifiers, are skipped.
+func runPCRE2Output(t *testing.T, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var (
+		re        *pcre.Regexp
+		utf       bool
+		defaults  string
+		pattern   []string
+		delim     byte
+		subj      *pcre2Subject
+		inSubject bool
+		ncase     int
+		nskip     int
+	)
+	defer func() { re.Close() }()
+
+	finish := func() {
+		if subj == nil {
+			return
+		}
+		ncase++
+		if re == nil || subj.skip {
+			nskip++
+		} else {
+			checkPCRE2Subject(t, path, re, utf, subj)
+		}
+		subj = nil
+	}
+
+	startPattern := func(text string) {
+		re.Close()
+		re = nil
+
+		end := strings.LastIndexByte(text, delim)
+		expr, modifiers := text[1:end], text[end+1:]
+		if defaults != "" {
+			modifiers = strings.Join([]string{defaults, modifiers}, ",")
+		}
+		options, ok := parsePCRE2Modifiers(modifiers)
+		if !ok {
+			return
+		}
+
+		re, err = pcre.CompileOpts(expr, options)
+		if err != nil {
+			// Compile errors are reported in the output file
+			re = nil
+			return
+		}
+		utf = options&pcre.UTF != 0 || strings.HasPrefix(expr, "(*UTF)")
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+
+		// Continuation of a pattern spanning multiple lines
+		if pattern != nil {
+			pattern = append(pattern, line)
+			if pcre2PatternEnd(line, delim) {
+				startPattern(strings.Join(pattern, "\n"))
+				pattern = nil
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			finish()
+			inSubject = false
+		case strings.HasPrefix(line, "#"):
+			if directive, args, _ := strings.Cut(line, " "); directive == "#pattern" {
+				defaults = args
+			} else if directive != "#" && directive != "#perltest" {
+				// Other directives, such as changing the newline
+				// convention, aren't supported.
+				defaults = "unsupported"
+			}
+		case !inSubject && line[0] != ' ' && line[0] != '\\':
+			finish()
+			inSubject = true
+			delim = line[0]
+			if pcre2PatternEnd(line[1:], delim) {
+				startPattern(line)
+			} else {
+				pattern = []string{line}
+			}
+		case strings.HasPrefix(line, `\=`):
+			// Comments such as "\= Expect no match"
+		case strings.HasPrefix(line, "    "):
+			finish()
+			subject, ok := parsePCRE2Subject(trimmed, utf)
+			subj = &pcre2Subject{lineno: lineno, subject: subject, skip: !ok}
+		case subj != nil && pcre2ResultLine(line):
+			_, result, _ := strings.Cut(line, ":")
+			subj.results = append(subj.results, strings.TrimPrefix(result, " "))
+		case subj != nil && strings.HasPrefix(line, "No match"):
+			subj.noMatch = true
+		case subj != nil:
+			// Other output, such as partial matches,
+			// errors and callouts, isn't supported.
+			subj.skip = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	finish()
+	t.Logf("%s: %d cases tested, %d skipped", path, ncase-nskip, nskip)
+}
+
+// checkPCRE2Subject compares the first match of the
+// subject with the results from the output file.
+func checkPCRE2Subject(t *testing.T, path string, re *pcre.Regexp, utf bool, subj *pcre2Subject) {
+	t.Helper()
+
+	var match []int
+	failed := func() (failed bool) {
+		// Match errors are reported by panicking. Subjects with
+		// expected errors are skipped, so any error is a failure.
+		defer func() {
+			if err := recover(); err != nil {
+				t.Errorf("%s:%d: %#q.FindSubmatch(%q) panicked: %v", path, subj.lineno, re, subj.subject, err)
+				failed = true
+			}
+		}()
+		match = re.FindSubmatchIndex(subj.subject)
+		return false
+	}()
+	if failed {
+		return
+	}
+
+	// pcre2test only prints groups up to the highest one that was set
+	for len(match) > 2 && match[len(match)-2] == -1 {
+		match = match[:len(match)-2]
+	}
+
+	var have []string
+	for i := 0; i < len(match); i += 2 {
+		if match[i] == -1 {
+			have = append(have, "<unset>")
+		} else {
+			have = append(have, pcre2Escape(subj.subject[match[i]:match[i+1]], utf))
+		}
+	}
+
+	if !reflect.DeepEqual(have, subj.results) {
+		t.Errorf("%s:%d: %#q.FindSubmatch(%q) = %q, want %q", path, subj.lineno, re, subj.subject, have, subj.results)
+	}
+}
+
+// pcre2PatternEnd reports whether the line contains the closing delimiter
+func pcre2PatternEnd(line string, delim byte) bool {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case delim:
+			return true
+		}
+	}
+	return false
+}
+
+// pcre2ResultLine reports whether the line is a captured
+// group, such as " 0: abc" or "12: <unset>".
+func pcre2ResultLine(line string) bool {
+	num, _, ok := strings.Cut(line, ":")
+	if !ok || len(num) < 2 {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimPrefix(num, " "))
+	return err == nil
+}
+
+// parsePCRE2Modifiers converts pcre2test pattern modifiers to
+// compile options, reporting whether they are all supported.
+func parsePCRE2Modifiers(modifiers string) (pcre.CompileOption, bool) {
+	var options pcre.CompileOption
+	for _, mod := range strings.Split(modifiers, ",") {
+		mod = strings.TrimSpace(mod)
+		if mod == "" {
+			continue
+		}
+
+		if opt, ok := pcre2Modifiers[mod]; ok {
+			options |= opt
+			continue
+		}
+
+		// Single-letter modifiers may be combined, such as in /imsx
+		for _, c := range mod {
+			opt, ok := pcre2Modifiers[string(c)]
+			if !ok {
+				return 0, false
+			}
+			options |= opt
+		}
+	}
+	return options, true
+}
+
+// parsePCRE2Subject processes the escape sequences in a subject line,
+// reporting whether the subject is supported.
+func parsePCRE2Subject(line string, utf bool) ([]byte, bool) {
+	var out []byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+
+		i++
+		if i == len(line) {
+			// A trailing backslash is ignored
+			break
+		}
+
+		switch c = line[i]; c {
+		case 'a':
+			out = append(out, '\a')
+		case 'e':
+			out = append(out, 0x1b)
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case 'x':
+			// \x{hh...} is a character, but \xhh is always a single
+			// byte, so that invalid UTF-8 can be constructed.
+			var digits string
+			braced := strings.HasPrefix(line[i+1:], "{")
+			if braced {
+				end := strings.IndexByte(line[i:], '}')
+				if end == -1 {
+					return nil, false
+				}
+				digits = line[i+2 : i+end]
+				i += end
+			} else {
+				n := 0
+				for n < 2 && i+1+n < len(line) && strings.IndexByte("0123456789abcdefABCDEF", line[i+1+n]) != -1 {
+					n++
+				}
+				digits = line[i+1 : i+1+n]
+				i += n
+			}
+
+			v, err := strconv.ParseUint(digits, 16, 32)
+			if err != nil {
+				return nil, false
+			}
+			out = appendPCRE2Char(out, rune(v), utf && braced)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 1
+			for n < 3 && i+n < len(line) && line[i+n] >= '0' && line[i+n] <= '7' {
+				n++
+			}
+			v, _ := strconv.ParseUint(line[i:i+n], 8, 32)
+			out = appendPCRE2Char(out, rune(v), utf)
+			i += n - 1
+		case '=':
+			// Subject modifiers aren't supported
+			return nil, false
+		default:
+			if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' {
+				return nil, false
+			}
+			out = append(out, c)
+		}
+	}
+	return out, true
+}
+
+// appendPCRE2Char appends a character from a subject escape sequence,
+// encoding it as UTF-8 if utf is set, or as a single byte otherwise.
+func appendPCRE2Char(b []byte, r rune, utf bool) []byte {
+	if utf {
+		return append(b, string(r)...)
+	}
+	return append(b, byte(r))
+}
+
+// pcre2Escape formats matched text the way pcre2test prints it
+func pcre2Escape(b []byte, utf bool) string {
+	var sb strings.Builder
+	for len(b) > 0 {
+		r, size := rune(b[0]), 1
+		if utf {
+			r, size = utf8.DecodeRune(b)
+		}
+		b = b[size:]
+
+		switch {
+		case r >= 0x20 && r < 0x7f:
+			sb.WriteRune(r)
+		case utf:
+			fmt.Fprintf(&sb, `\x{%02x}`, r)
+		default:
+			fmt.Fprintf(&sb, `\x%02x`, r)
+		}
+	}
+	return sb.String()
+}
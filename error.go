@@ -63,7 +63,7 @@ func codeToError(tls *libc.TLS, code int32) *PcreError {
 	// and store it in errBuf.
 	msgLen := lib.Xpcre2_get_error_message_8(tls, code, cErrBuf, 256)
 
-	return &PcreError{false, 0, string(errBuf[:msgLen])}
+	return &PcreError{false, 0, code, string(errBuf[:msgLen])}
 }
 
 // PcreError represents errors returned
@@ -71,6 +71,7 @@ func codeToError(tls *libc.TLS, code int32) *PcreError {
 type PcreError struct {
 	hasOffset bool
 	offset    lib.Tsize_t
+	code      int32
 	errStr    string
 }
 
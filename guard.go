@@ -0,0 +1,98 @@
+package pcre
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+
+	"modernc.org/libc"
+)
+
+// GuardError is returned by CompileWith when compilation
+// was aborted by CompileConfig.RecursionGuard, or because
+// CompileConfig.Context was done.
+type GuardError struct {
+	// Depth is the nesting depth of parentheses
+	// at which compilation was aborted.
+	Depth int
+	// Err is the error returned by the guard,
+	// or the error of the context.
+	Err error
+}
+
+// Error returns the error message
+func (e *GuardError) Error() string {
+	return fmt.Sprintf("compilation aborted at nesting depth %d: %v", e.Depth, e.Err)
+}
+
+// Unwrap returns the error returned by the guard or context
+func (e *GuardError) Unwrap() error {
+	return e.Err
+}
+
+// compileGuard contains the guard and context of a single compilation
+type compileGuard struct {
+	fn  func(depth int) error
+	ctx context.Context
+	err *GuardError
+}
+
+var (
+	// guards maps the IDs passed to pcre2 as guard data to the
+	// guards of running compilations, as pcre2 only stores integers.
+	guards      sync.Map
+	lastGuardID uint64
+)
+
+// setCompileGuard makes pcre2 call the guard function and check the
+// context of the config while compiling with cctx, if either is set.
+// The returned function must be called once compilation is done,
+// and returns the error that aborted compilation, if any.
+func setCompileGuard(tls *libc.TLS, cctx uintptr, config CompileConfig) func() *GuardError {
+	if config.RecursionGuard == nil && config.Context == nil {
+		return func() *GuardError { return nil }
+	}
+
+	guard := &compileGuard{fn: config.RecursionGuard, ctx: config.Context}
+	id := uintptr(atomic.AddUint64(&lastGuardID, 1))
+	guards.Store(id, guard)
+
+	guardFn := *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uint32, uintptr) int32
+	}{callCompileGuard}))
+	lib.Xpcre2_set_compile_recursion_guard_8(tls, cctx, guardFn, id)
+
+	return func() *GuardError {
+		guards.Delete(id)
+		return guard.err
+	}
+}
+
+// callCompileGuard is the recursion guard function used by pcre2.
+// The guard data passed by pcre2 is the ID of the compilation's guard.
+// It returns non-zero to abort compilation.
+func callCompileGuard(_ *libc.TLS, depth uint32, id uintptr) int32 {
+	val, ok := guards.Load(id)
+	if !ok {
+		return 0
+	}
+	guard := val.(*compileGuard)
+
+	var err error
+	if guard.ctx != nil {
+		err = guard.ctx.Err()
+	}
+	if err == nil && guard.fn != nil {
+		err = guard.fn(int(depth))
+	}
+	if err == nil {
+		return 0
+	}
+
+	guard.err = &GuardError{Depth: int(depth), Err: err}
+	return 1
+}
@@ -0,0 +1,104 @@
+package pcre_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestRecursionGuard(t *testing.T) {
+	errTooDeep := errors.New("too deep")
+	maxDepth := 0
+	config := pcre.CompileConfig{
+		RecursionGuard: func(depth int) error {
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+			if depth > 10 {
+				return errTooDeep
+			}
+			return nil
+		},
+	}
+
+	r, err := pcre.CompileWith(`((a)(b(c)))`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if maxDepth == 0 {
+		t.Error("expected guard to be called with nested groups")
+	}
+
+	pattern := strings.Repeat("(", 50) + "a" + strings.Repeat(")", 50)
+	_, err = pcre.CompileWith(pattern, config)
+	var ge *pcre.GuardError
+	if !errors.As(err, &ge) {
+		t.Fatalf("expected guard error, got %v", err)
+	}
+	if ge.Depth != 11 || !errors.Is(err, errTooDeep) {
+		t.Errorf("expected guard error at depth 11, got %v", err)
+	}
+}
+
+func TestCompileContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := pcre.CompileWith(`a`, pcre.CompileConfig{Context: ctx})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected canceled error, got %v", err)
+	}
+
+	// Cancel compilation while it's running
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	config := pcre.CompileConfig{
+		Context: ctx,
+		RecursionGuard: func(depth int) error {
+			if depth == 3 {
+				cancel()
+			}
+			return nil
+		},
+	}
+	_, err = pcre.CompileWith(`(((((a)))))`, config)
+	var ge *pcre.GuardError
+	if !errors.As(err, &ge) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected guard error wrapping canceled error, got %v", err)
+	}
+}
+
+func TestCacheGuard(t *testing.T) {
+	c := pcre.NewCache(0)
+	errAbort := errors.New("abort")
+
+	_, err := c.GetWith(`(a)`, pcre.CompileConfig{
+		RecursionGuard: func(int) error { return errAbort },
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected guard error, got %v", err)
+	}
+
+	// The aborted compilation isn't cached, and the guard
+	// isn't part of the key of the expression.
+	r, err := c.GetWith(`(a)`, pcre.CompileConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Release(r)
+
+	r2, err := c.GetWith(`(a)`, pcre.CompileConfig{
+		RecursionGuard: func(int) error { return errAbort },
+	})
+	if err != nil {
+		t.Fatalf("expected cached expression, got %v", err)
+	}
+	defer c.Release(r2)
+	if r != r2 {
+		t.Error("expected the same expression")
+	}
+}
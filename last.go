@@ -0,0 +1,169 @@
+package pcre
+
+import (
+	"runtime"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre/lib"
+)
+
+// lastChunkSize is the size of the first window searched by the FindLast
+// methods. Each following window is twice as large as the previous one.
+const lastChunkSize = 4096
+
+// FindLast returns the match of the regular expression that starts
+// closest to the end of b. A return value of nil indicates no match.
+//
+// The subject is searched backward in windows of increasing size, so
+// the cost depends on the distance of the match from the end rather
+// than on the length of b. Each window is matched within the whole
+// subject, so lookbehinds and lookaheads see the text around it.
+//
+// The result is the match with the greatest start position, which
+// may differ from the last match returned by FindAll, as FindAll
+// doesn't return matches that overlap a previous match. For example,
+// `\d+` matches "3" in "a333", so patterns should be anchored with
+// assertions such as \b where that matters.
+func (r *Regexp) FindLast(b []byte) []byte {
+	match := r.FindLastIndex(b)
+	if match == nil {
+		return nil
+	}
+	return b[match[0]:match[1]]
+}
+
+// FindLastIndex returns a two-element slice of integers
+// representing the location of the match found by FindLast.
+func (r *Regexp) FindLastIndex(b []byte) []int {
+	match := r.FindLastSubmatchIndex(b)
+	if match == nil {
+		return nil
+	}
+	return match[:2]
+}
+
+// FindLastSubmatch returns a slice containing the match found by
+// FindLast as the first element, and its submatches as the
+// subsequent elements.
+func (r *Regexp) FindLastSubmatch(b []byte) [][]byte {
+	match := r.FindLastSubmatchIndex(b)
+	if match == nil {
+		return nil
+	}
+
+	out := make([][]byte, 0, len(match)/2)
+	for i := 0; i < len(match); i += 2 {
+		if match[i] == -1 {
+			out = append(out, nil)
+		} else {
+			out = append(out, b[match[i]:match[i+1]])
+		}
+	}
+	return out
+}
+
+// FindLastSubmatchIndex returns a slice of index pairs representing
+// the match found by FindLast and its submatches, if any.
+func (r *Regexp) FindLastSubmatchIndex(b []byte) []int {
+	match, err := r.last(b)
+	if err != nil {
+		panic(err)
+	}
+	return match
+}
+
+// FindLastString is the String version of FindLast
+func (r *Regexp) FindLastString(s string) string {
+	match := r.FindLastIndex([]byte(s))
+	if match == nil {
+		return ""
+	}
+	return s[match[0]:match[1]]
+}
+
+// FindLastStringIndex is the String version of FindLastIndex
+func (r *Regexp) FindLastStringIndex(s string) []int {
+	return r.FindLastIndex([]byte(s))
+}
+
+// FindLastStringSubmatch is the String version of FindLastSubmatch
+func (r *Regexp) FindLastStringSubmatch(s string) []string {
+	match := r.FindLastSubmatchIndex([]byte(s))
+	if match == nil {
+		return nil
+	}
+
+	out := make([]string, 0, len(match)/2)
+	for i := 0; i < len(match); i += 2 {
+		if match[i] == -1 {
+			out = append(out, "")
+		} else {
+			out = append(out, s[match[i]:match[i+1]])
+		}
+	}
+	return out
+}
+
+// FindLastStringSubmatchIndex is the String version of FindLastSubmatchIndex
+func (r *Regexp) FindLastStringSubmatchIndex(s string) []int {
+	return r.FindLastSubmatchIndex([]byte(s))
+}
+
+// last finds the match with the greatest start position, searching
+// backward from the end of the subject in windows of increasing size.
+func (r *Regexp) last(b []byte) ([]int, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	st, err := r.getState()
+	if err != nil {
+		return nil, err
+	}
+	defer r.putState(st)
+
+	b, skipped := r.skipInvalidUTF(b)
+	cSubject := subjectPointer(b)
+	cSubjectLen := lib.Tsize_t(len(b))
+	slice := st.ovec
+
+	end := len(b)
+	for size := lastChunkSize; ; size *= 2 {
+		start := end - size
+		if start < 0 {
+			start = 0
+		}
+		// Windows must start at a character boundary
+		for r.utf && start > 0 && !utf8.RuneStart(b[start]) {
+			start--
+		}
+
+		// Find the match with the greatest start position in the window.
+		// Matches starting at or after the end of the window were already
+		// ruled out by the previous window, so none can be found.
+		var match []int
+		offset := lib.Tsize_t(start)
+		for offset <= cSubjectLen {
+			ret := r.exec(st, cSubject, cSubjectLen, offset, 0, st.md)
+			if ret == lib.DPCRE2_ERROR_NOMATCH {
+				break
+			} else if ret < 0 {
+				return nil, r.matchError(st.tls, st.md, ret)
+			}
+
+			match = match[:0]
+			for _, offset := range slice {
+				match = append(match, int(offset))
+			}
+			offset = nextChar(b, slice[0], r.utf)
+		}
+
+		if match != nil || start == 0 {
+			runtime.KeepAlive(b)
+			skipped.remap(match)
+			return match, nil
+		}
+		end = start
+	}
+}
@@ -0,0 +1,98 @@
+package pcre_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestFindLast(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		options  pcre.CompileOption
+		subject  string
+		expected []int
+	}{
+		{`\d+`, 0, "a1 b22 c333 d", []int{10, 11}},
+		{`\b\d+`, 0, "a1 b22 c 333 d", []int{9, 12}},
+		{`aa`, 0, "aaa", []int{1, 3}},
+		{`x*`, 0, "ab", []int{2, 2}},
+		{`(?<=a)b`, 0, "ab b ab", []int{6, 7}},
+		{`^\w+`, pcre.Multiline, "one\ntwo\nthree", []int{8, 13}},
+		{`é`, pcre.UTF, "éaé", []int{3, 5}},
+		{`z`, 0, "abc", nil},
+		{`a?`, 0, "", []int{0, 0}},
+	}
+
+	for _, test := range tests {
+		r := pcre.MustCompileOpts(test.pattern, test.options)
+
+		got := r.FindLastStringIndex(test.subject)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.pattern, test.expected, got)
+		}
+
+		// The result should be the last of the overlapping matches
+		all := r.FindAllStringOverlappingIndex(test.subject, -1)
+		if len(all) > 0 && !reflect.DeepEqual(got, all[len(all)-1]) {
+			t.Errorf("%s: expected last overlapping match %v, got %v", test.pattern, all[len(all)-1], got)
+		}
+
+		r.Close()
+	}
+}
+
+func TestFindLastLarge(t *testing.T) {
+	r := pcre.MustCompile(`(\d{2}):(\d{2}):(\d{2})`)
+	defer r.Close()
+
+	var sb strings.Builder
+	sb.WriteString("12:00:00 start\n")
+	sb.WriteString("23:59:58 last\n")
+	for sb.Len() < 1<<20 {
+		sb.WriteString("no timestamp on this line\n")
+	}
+	subject := sb.String()
+
+	expected := []string{"23:59:58", "23", "59", "58"}
+	if got := r.FindLastStringSubmatch(subject); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	if got := r.FindLastString(subject); got != "23:59:58" {
+		t.Errorf("expected 23:59:58, got %q", got)
+	}
+
+	if got := r.FindLastSubmatch([]byte("x")); got != nil {
+		t.Errorf("expected nil, got %q", got)
+	}
+
+	// A lookbehind can see the text before the searched window
+	r = pcre.MustCompile(`(?<=start\n(?s:.{14}))x`)
+	defer r.Close()
+	if got := r.FindLastIndex([]byte("start\n" + strings.Repeat(".", 14) + "x" + strings.Repeat("y", 10000))); !reflect.DeepEqual(got, []int{20, 21}) {
+		t.Errorf("expected [20 21], got %v", got)
+	}
+}
+
+func BenchmarkFindLast(b *testing.B) {
+	r := pcre.MustCompile(`\d{2}:\d{2}:\d{2}`)
+	defer r.Close()
+
+	subject := []byte(strings.Repeat("12:00:00 a log line with a timestamp\n", 1<<15))
+
+	b.Run("FindLastIndex", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.FindLastIndex(subject)
+		}
+	})
+
+	b.Run("FindAllIndex", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matches := r.FindAllIndex(subject, -1)
+			_ = matches[len(matches)-1]
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package pcre_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.elara.ws/pcre"
+)
+
+func TestCloseIdempotent(t *testing.T) {
+	r := pcre.MustCompile(`\d+`)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Close(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+
+	var zero *pcre.Regexp
+	if err := zero.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	r := pcre.MustCompile(`(?<n>\d+)`)
+	m := r.NewMatchData()
+	defer m.Close()
+	r.Close()
+
+	if err := r.SetMatchLimit(10); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if err := r.SetCallout(func(*pcre.CalloutBlock) int32 { return 0 }); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, err := r.Trace("123"); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, err := r.Profile("123"); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+
+	funcs := map[string]func(){
+		"FindString":       func() { r.FindString("123") },
+		"FindAllIndex":     func() { r.FindAllIndex([]byte("123"), -1) },
+		"MatchString":      func() { r.MatchString("123") },
+		"ReplaceAllString": func() { r.ReplaceAllString("123", "x") },
+		"FindLastIndex":    func() { r.FindLastIndex([]byte("123")) },
+		"FindEveryIndex":   func() { r.FindEveryIndex([]byte("123"), -1) },
+		"NumSubexp":        func() { r.NumSubexp() },
+		"SubexpNames":      func() { r.SubexpNames() },
+		"SubexpIndex":      func() { r.SubexpIndex("n") },
+		"Clone":            func() { r.Clone() },
+		"NewMatchData":     func() { r.NewMatchData() },
+		"MatchData":        func() { m.MatchString("123") },
+		"LiteralPrefix":    func() { r.LiteralPrefix() },
+		"MemStats":         func() { r.MemStats() },
+	}
+
+	for name, fn := range funcs {
+		func() {
+			defer func() {
+				if err, _ := recover().(error); !errors.Is(err, pcre.ErrClosed) {
+					t.Errorf("%s: expected panic with ErrClosed, got %v", name, err)
+				}
+			}()
+			fn()
+		}()
+	}
+
+	// Methods that don't use pcre2 still work
+	if r.String() != `(?<n>\d+)` {
+		t.Errorf("unexpected expression %q", r.String())
+	}
+}
+
+func TestCloseWaitsForMatches(t *testing.T) {
+	r := pcre.MustCompile(`a(?C1)`)
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	err := r.SetCallout(func(*pcre.CalloutBlock) int32 {
+		close(started)
+		<-finish
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched := make(chan bool)
+	go func() {
+		matched <- r.MatchString("a")
+	}()
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the running match")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(finish)
+	if !<-matched {
+		t.Error("expected match to succeed")
+	}
+	<-closed
+}
+
+func TestReloadWhileMatching(t *testing.T) {
+	var mtx sync.Mutex
+	r := pcre.MustCompile(`\w+`)
+
+	wg := &sync.WaitGroup{}
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				mtx.Lock()
+				cur := r
+				mtx.Unlock()
+
+				func() {
+					// Matching an expression that was just replaced
+					// either succeeds or fails with ErrClosed.
+					defer func() {
+						if err, _ := recover().(error); err != nil && !errors.Is(err, pcre.ErrClosed) {
+							t.Errorf("unexpected panic: %v", err)
+						}
+					}()
+					cur.FindAllString(strings.Repeat("word ", 100), -1)
+				}()
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		mtx.Lock()
+		old := r
+		r = pcre.MustCompile(`\w+`)
+		mtx.Unlock()
+		old.Close()
+	}
+
+	close(stop)
+	wg.Wait()
+	r.Close()
+}
@@ -0,0 +1,202 @@
+package pcre
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+)
+
+// ErrMatchDataClosed is used as the panic value
+// when match data is used after it was closed.
+var ErrMatchDataClosed = errors.New("match data is closed")
+
+// MatchData holds the state needed to match a regular expression,
+// so that it can be reused between matches. Once created, its methods
+// don't allocate any memory, except for growing the slices passed to
+// them, removing invalid UTF-8 from subjects with the UTFSkip policy,
+// and, if Longest was called, the DFA workspace, which is allocated
+// by the first match and kept for later ones.
+//
+// A MatchData may only be used by one goroutine at a time, but any
+// number of MatchData values for the same Regexp may be used
+// concurrently. The Regexp must not be closed while a MatchData
+// is in use.
+type MatchData struct {
+	r *Regexp
+	// st is nil once the match data is closed
+	st *matchState
+}
+
+// NewMatchData creates match data for the regular expression.
+//
+// Close() should be called on the returned match data
+// once it is no longer needed.
+func (r *Regexp) NewMatchData() *MatchData {
+	if err := r.acquire(); err != nil {
+		panic(err)
+	}
+	defer r.release()
+
+	st, err := r.newMatchState()
+	if err != nil {
+		panic(err)
+	}
+	m := &MatchData{r: r, st: st}
+
+	// The expression keeps track of the match state, so
+	// it's freed if GC collects the match data before
+	// the expression is closed.
+	runtime.SetFinalizer(m, func(m *MatchData) {
+		m.Close()
+	})
+	return m
+}
+
+// Match reports whether b contains any match of the regular expression
+func (m *MatchData) Match(b []byte) bool {
+	matched, _ := m.exec(b)
+	return matched
+}
+
+// MatchString is the String version of Match
+func (m *MatchData) MatchString(s string) bool {
+	return m.Match(stringBytes(s))
+}
+
+// FindIndexInto stores the location of the leftmost match in dst,
+// reusing its underlying array if it's large enough, and returns it.
+// A return value of nil indicates no match, so callers that reuse dst
+// should keep their own reference to it.
+func (m *MatchData) FindIndexInto(dst []int, b []byte) []int {
+	matched, skipped := m.exec(b)
+	if !matched {
+		return nil
+	}
+	dst = append(dst[:0], int(m.st.ovec[0]), int(m.st.ovec[1]))
+	skipped.remap(dst)
+	return dst
+}
+
+// FindStringIndexInto is the String version of FindIndexInto
+func (m *MatchData) FindStringIndexInto(dst []int, s string) []int {
+	return m.FindIndexInto(dst, stringBytes(s))
+}
+
+// FindSubmatchIndexInto stores the index pairs of the leftmost match
+// and its submatches in dst, reusing its underlying array if it's large
+// enough, and returns it. A return value of nil indicates no match.
+func (m *MatchData) FindSubmatchIndexInto(dst []int, b []byte) []int {
+	matched, skipped := m.exec(b)
+	if !matched {
+		return nil
+	}
+
+	dst = dst[:0]
+	for _, offset := range m.st.ovec {
+		dst = append(dst, int(offset))
+	}
+	skipped.remap(dst)
+	return dst
+}
+
+// FindStringSubmatchIndexInto is the String version of FindSubmatchIndexInto
+func (m *MatchData) FindStringSubmatchIndexInto(dst []int, s string) []int {
+	return m.FindSubmatchIndexInto(dst, stringBytes(s))
+}
+
+// CountAll returns the number of successive matches of the
+// regular expression in b, as would be returned by FindAllIndex.
+func (m *MatchData) CountAll(b []byte) int {
+	if m.st == nil {
+		panic(ErrMatchDataClosed)
+	}
+	if err := m.r.acquire(); err != nil {
+		panic(err)
+	}
+	defer m.r.release()
+
+	if err := m.r.syncState(m.st); err != nil {
+		panic(err)
+	}
+
+	b, _ = m.r.skipInvalidUTF(b)
+	cSubject := subjectPointer(b)
+	cSubjectLen := lib.Tsize_t(len(b))
+
+	count := 0
+	var offset lib.Tsize_t
+	prevEnd := lib.Tsize_t(Unset)
+	for offset <= cSubjectLen {
+		ret := m.r.exec(m.st, cSubject, cSubjectLen, offset, 0, m.st.md)
+		if ret == lib.DPCRE2_ERROR_NOMATCH {
+			break
+		} else if ret < 0 {
+			panic(m.r.matchError(m.st.tls, m.st.md, ret))
+		}
+
+		var accept bool
+		accept, offset, prevEnd = nextMatch(b, m.st.ovec, offset, prevEnd, m.r.utf)
+		if accept {
+			count++
+		}
+	}
+
+	runtime.KeepAlive(b)
+	return count
+}
+
+// CountAllString is the String version of CountAll
+func (m *MatchData) CountAllString(s string) int {
+	return m.CountAll(stringBytes(s))
+}
+
+// exec matches the regular expression against b and reports whether
+// there was a match, along with the mapping needed to convert the
+// offsets in the match data if invalid UTF-8 was removed from b.
+// It panics if matching fails.
+func (m *MatchData) exec(b []byte) (bool, skippedUTF) {
+	if m.st == nil {
+		panic(ErrMatchDataClosed)
+	}
+	if err := m.r.acquire(); err != nil {
+		panic(err)
+	}
+	defer m.r.release()
+
+	if err := m.r.syncState(m.st); err != nil {
+		panic(err)
+	}
+
+	b, skipped := m.r.skipInvalidUTF(b)
+	ret := m.r.exec(m.st, subjectPointer(b), lib.Tsize_t(len(b)), 0, 0, m.st.md)
+	runtime.KeepAlive(b)
+	if ret == lib.DPCRE2_ERROR_NOMATCH {
+		return false, skipped
+	} else if ret < 0 {
+		panic(m.r.matchError(m.st.tls, m.st.md, ret))
+	}
+	return true, skipped
+}
+
+// Close frees resources used by the match data. They're also
+// freed when the expression is closed. Once the match data is
+// closed, its methods panic with ErrMatchDataClosed.
+func (m *MatchData) Close() error {
+	if m != nil && m.st != nil {
+		runtime.SetFinalizer(m, nil)
+		m.r.closeState(m.st)
+		m.st = nil
+	}
+	return nil
+}
+
+// stringBytes returns the bytes of s without copying them.
+// The returned slice must not be modified.
+func stringBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return unsafe.Slice(*(**byte)(unsafe.Pointer(&s)), len(s))
+}
@@ -0,0 +1,165 @@
+package pcre_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestMatchData(t *testing.T) {
+	r := pcre.MustCompile(`(\w+)@(\w+)?\.com`)
+	defer r.Close()
+
+	m := r.NewMatchData()
+	defer m.Close()
+
+	subject := "mail bob@.com or alice@example.com"
+	if got, expected := m.FindStringIndexInto(nil, subject), r.FindStringIndex(subject); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got, expected := m.FindStringSubmatchIndexInto(nil, subject), r.FindStringSubmatchIndex(subject); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := m.CountAllString(subject); got != 2 {
+		t.Errorf("expected 2 matches, got %d", got)
+	}
+
+	if !m.MatchString(subject) {
+		t.Error("expected subject to match")
+	}
+	if m.Match([]byte("no addresses")) {
+		t.Error("expected no match")
+	}
+	if got := m.FindIndexInto(make([]int, 2), []byte("none")); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+
+	// The destination's array is reused
+	dst := make([]int, 0, 6)
+	if got := m.FindSubmatchIndexInto(dst, []byte(subject)); &got[0] != &dst[:1][0] {
+		t.Error("expected destination array to be reused")
+	}
+
+	// Match data can't be used after it's closed
+	m.Close()
+	defer func() {
+		if err := recover(); err != pcre.ErrMatchDataClosed {
+			t.Errorf("expected ErrMatchDataClosed, got %v", err)
+		}
+	}()
+	m.MatchString(subject)
+}
+
+func TestMatchDataCountAll(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+	}{
+		{`\d+`, "1 22 333"},
+		{`x*`, "abc"},
+		{`a|`, "baaab"},
+		{`\b`, "hello world"},
+		{`.`, ""},
+	}
+
+	for _, test := range tests {
+		r := pcre.MustCompileOpts(test.pattern, pcre.UTF)
+		m := r.NewMatchData()
+
+		expected := len(r.FindAllStringIndex(test.subject, -1))
+		if got := m.CountAllString(test.subject); got != expected {
+			t.Errorf("%s: expected %d matches, got %d", test.pattern, expected, got)
+		}
+
+		m.Close()
+		r.Close()
+	}
+}
+
+func TestMatchDataConcurrency(t *testing.T) {
+	r := pcre.MustCompile(`\d+`)
+	defer r.Close()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := r.NewMatchData()
+			defer m.Close()
+
+			for j := 0; j < 100; j++ {
+				if got := m.CountAllString("1 22 333"); got != 3 {
+					t.Errorf("expected 3 matches, got %d", got)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMatchDataAllocs(t *testing.T) {
+	r := pcre.MustCompile(`(\d+)-(\d+)`)
+	defer r.Close()
+
+	m := r.NewMatchData()
+	defer m.Close()
+
+	line := "order 1234-5678 shipped"
+	dst := make([]int, 0, 6)
+	allocs := testing.AllocsPerRun(1000, func() {
+		dst = m.FindStringSubmatchIndexInto(dst, line)
+		m.CountAllString(line)
+		m.MatchString(line)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+
+	// The DFA workspace is reused after the first match
+	r.Longest()
+	allocs = testing.AllocsPerRun(1000, func() {
+		dst = m.FindStringSubmatchIndexInto(dst, line)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations with Longest, got %v", allocs)
+	}
+}
+
+func BenchmarkMatchData(b *testing.B) {
+	r := pcre.MustCompile(`(\d+)-(\d+)`)
+	defer r.Close()
+
+	lines := strings.Split(strings.Repeat("order 1234-5678 shipped\nno order here\n", 64), "\n")
+
+	b.Run("FindStringSubmatchIndex", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r.FindStringSubmatchIndex(lines[i%len(lines)])
+		}
+	})
+
+	b.Run("FindStringSubmatchIndexInto", func(b *testing.B) {
+		m := r.NewMatchData()
+		defer m.Close()
+
+		b.ReportAllocs()
+		dst := make([]int, 0, 6)
+		for i := 0; i < b.N; i++ {
+			m.FindStringSubmatchIndexInto(dst, lines[i%len(lines)])
+		}
+	})
+
+	b.Run("CountAll", func(b *testing.B) {
+		m := r.NewMatchData()
+		defer m.Close()
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.CountAllString(lines[i%len(lines)])
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package pcre
+
+import "regexp"
+
+// Matcher contains the methods shared by regular expressions from this
+// package and Go's regexp package, so that code can accept either engine.
+// *StdRegexp adapts a Go regular expression to this interface.
+//
+// The methods ending in Err return the errors that the other methods
+// of a *Regexp panic with, such as exceeded limits. They always return
+// a nil error for a *StdRegexp.
+type Matcher interface {
+	Find(b []byte) []byte
+	FindIndex(b []byte) []int
+	FindAll(b []byte, n int) [][]byte
+	FindAllIndex(b []byte, n int) [][]int
+	FindSubmatch(b []byte) [][]byte
+	FindSubmatchIndex(b []byte) []int
+	FindAllSubmatch(b []byte, n int) [][][]byte
+	FindAllSubmatchIndex(b []byte, n int) [][]int
+	FindString(s string) string
+	FindStringIndex(s string) []int
+	FindAllString(s string, n int) []string
+	FindAllStringIndex(s string, n int) [][]int
+	FindStringSubmatch(s string) []string
+	FindStringSubmatchIndex(s string) []int
+	FindAllStringSubmatch(s string, n int) [][]string
+	FindAllStringSubmatchIndex(s string, n int) [][]int
+	FindIndexErr(b []byte) ([]int, error)
+	FindAllIndexErr(b []byte, n int) ([][]int, error)
+	FindSubmatchIndexErr(b []byte) ([]int, error)
+	FindAllSubmatchIndexErr(b []byte, n int) ([][]int, error)
+	FindStringIndexErr(s string) ([]int, error)
+	FindAllStringIndexErr(s string, n int) ([][]int, error)
+	FindStringSubmatchIndexErr(s string) ([]int, error)
+	FindAllStringSubmatchIndexErr(s string, n int) ([][]int, error)
+	Longest()
+	Match(b []byte) bool
+	MatchString(s string) bool
+	MatchErr(b []byte) (bool, error)
+	MatchStringErr(s string) (bool, error)
+	NumSubexp() int
+	ReplaceAll(src, repl []byte) []byte
+	ReplaceAllFunc(src []byte, repl func([]byte) []byte) []byte
+	ReplaceAllLiteral(src, repl []byte) []byte
+	ReplaceAllString(src, repl string) string
+	ReplaceAllStringFunc(src string, repl func(string) string) string
+	ReplaceAllLiteralString(src, repl string) string
+	Split(s string, n int) []string
+	String() string
+	SubexpIndex(name string) int
+	SubexpNames() []string
+	Close() error
+}
+
+var (
+	_ Matcher = (*Regexp)(nil)
+	_ Matcher = (*StdRegexp)(nil)
+)
+
+// StdRegexp wraps a regular expression from
+// Go's regexp package to implement Matcher.
+type StdRegexp struct {
+	*regexp.Regexp
+	expr string
+}
+
+// WrapStd returns a StdRegexp wrapping r
+func WrapStd(r *regexp.Regexp) *StdRegexp {
+	return &StdRegexp{Regexp: r, expr: r.String()}
+}
+
+// CompileStd compiles the provided pattern using Go's regexp
+// package and wraps the result to implement Matcher.
+func CompileStd(pattern string) (*StdRegexp, error) {
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return WrapStd(r), nil
+}
+
+// MustCompileStd compiles the given pattern using CompileStd
+// and panics if there was an error.
+func MustCompileStd(pattern string) *StdRegexp {
+	sr, err := CompileStd(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return sr
+}
+
+// CompileStdPOSIX is like CompileStd but uses regexp.CompilePOSIX,
+// which restricts the syntax to POSIX ERE and uses
+// leftmost-longest matching.
+func CompileStdPOSIX(pattern string) (*StdRegexp, error) {
+	r, err := regexp.CompilePOSIX(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return WrapStd(r), nil
+}
+
+// MustCompileStdPOSIX compiles the given pattern using CompileStdPOSIX
+// and panics if there was an error.
+func MustCompileStdPOSIX(pattern string) *StdRegexp {
+	sr, err := CompileStdPOSIX(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return sr
+}
+
+// String returns the text of the regular expression
+// used for compilation.
+func (sr *StdRegexp) String() string {
+	return sr.expr
+}
+
+// Close does nothing, as Go regular expressions
+// don't need to be closed.
+func (sr *StdRegexp) Close() error {
+	return nil
+}
+
+// MatchErr is the same as Match, as Go regular
+// expressions don't fail to match.
+func (sr *StdRegexp) MatchErr(b []byte) (bool, error) {
+	return sr.Match(b), nil
+}
+
+// MatchStringErr is the String version of MatchErr
+func (sr *StdRegexp) MatchStringErr(s string) (bool, error) {
+	return sr.MatchString(s), nil
+}
+
+// FindIndexErr is the same as FindIndex
+func (sr *StdRegexp) FindIndexErr(b []byte) ([]int, error) {
+	return sr.FindIndex(b), nil
+}
+
+// FindStringIndexErr is the same as FindStringIndex
+func (sr *StdRegexp) FindStringIndexErr(s string) ([]int, error) {
+	return sr.FindStringIndex(s), nil
+}
+
+// FindAllIndexErr is the same as FindAllIndex
+func (sr *StdRegexp) FindAllIndexErr(b []byte, n int) ([][]int, error) {
+	return sr.FindAllIndex(b, n), nil
+}
+
+// FindAllStringIndexErr is the same as FindAllStringIndex
+func (sr *StdRegexp) FindAllStringIndexErr(s string, n int) ([][]int, error) {
+	return sr.FindAllStringIndex(s, n), nil
+}
+
+// FindSubmatchIndexErr is the same as FindSubmatchIndex
+func (sr *StdRegexp) FindSubmatchIndexErr(b []byte) ([]int, error) {
+	return sr.FindSubmatchIndex(b), nil
+}
+
+// FindStringSubmatchIndexErr is the same as FindStringSubmatchIndex
+func (sr *StdRegexp) FindStringSubmatchIndexErr(s string) ([]int, error) {
+	return sr.FindStringSubmatchIndex(s), nil
+}
+
+// FindAllSubmatchIndexErr is the same as FindAllSubmatchIndex
+func (sr *StdRegexp) FindAllSubmatchIndexErr(b []byte, n int) ([][]int, error) {
+	return sr.FindAllSubmatchIndex(b, n), nil
+}
+
+// FindAllStringSubmatchIndexErr is the same as FindAllStringSubmatchIndex
+func (sr *StdRegexp) FindAllStringSubmatchIndexErr(s string, n int) ([][]int, error) {
+	return sr.FindAllStringSubmatchIndex(s, n), nil
+}
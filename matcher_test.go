@@ -0,0 +1,110 @@
+package pcre_test
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestMatcher(t *testing.T) {
+	const pattern = `(?P<key>\w+)=(\w+)`
+	const subject = "a=1, bc=23"
+
+	matchers := []pcre.Matcher{
+		pcre.MustCompile(pattern),
+		pcre.MustCompileStd(pattern),
+		pcre.WrapStd(regexp.MustCompile(pattern)),
+	}
+
+	expected := regexp.MustCompile(pattern)
+	for _, m := range matchers {
+		if m.String() != pattern {
+			t.Errorf("%T: expected %s, got %s", m, pattern, m.String())
+		}
+
+		if !reflect.DeepEqual(m.SubexpNames(), expected.SubexpNames()) {
+			t.Errorf("%T: expected names %q, got %q", m, expected.SubexpNames(), m.SubexpNames())
+		}
+
+		got := m.FindAllStringSubmatchIndex(subject, -1)
+		if !reflect.DeepEqual(got, expected.FindAllStringSubmatchIndex(subject, -1)) {
+			t.Errorf("%T: unexpected matches %v", m, got)
+		}
+
+		gotErr, err := m.FindAllStringSubmatchIndexErr(subject, -1)
+		if err != nil || !reflect.DeepEqual(gotErr, got) {
+			t.Errorf("%T: expected %v without error, got %v and %v", m, got, gotErr, err)
+		}
+		if matched, err := m.MatchStringErr("x"); matched || err != nil {
+			t.Errorf("%T: expected no match without error, got %t and %v", m, matched, err)
+		}
+
+		out := m.ReplaceAllString(subject, "${key}:$2")
+		if out != "a:1, bc:23" {
+			t.Errorf("%T: unexpected replacement %s", m, out)
+		}
+
+		if err := m.Close(); err != nil {
+			t.Errorf("%T: %s", m, err)
+		}
+	}
+
+	_, err := pcre.CompileStd(`(?<=a)b`)
+	if err == nil {
+		t.Error("expected error for lookbehind in Go's regexp package")
+	}
+
+	sr := pcre.MustCompileStdPOSIX(`a|ab`)
+	if sr.FindString("ab") != "ab" {
+		t.Errorf("expected leftmost-longest match, got %s", sr.FindString("ab"))
+	}
+}
+
+func TestMatcherErr(t *testing.T) {
+	r := pcre.MustCompile(`(a+)+$`)
+	if err := r.SetMatchLimit(100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Errors that other methods panic with are returned
+	subject := strings.Repeat("a", 30) + "b"
+	if _, err := r.MatchStringErr(subject); err == nil {
+		t.Error("expected match limit error")
+	}
+	if _, err := r.FindAllStringIndexErr(subject, -1); err == nil {
+		t.Error("expected match limit error")
+	}
+
+	match, err := r.FindStringSubmatchIndexErr("aa")
+	if err != nil || !reflect.DeepEqual(match, []int{0, 2, 0, 2}) {
+		t.Errorf("expected [0 2 0 2] without error, got %v and %v", match, err)
+	}
+
+	clone, err := r.CloneErr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.Close()
+
+	r.Close()
+	if _, err := r.FindIndexErr([]byte("a")); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, err := r.CloneErr(); !errors.Is(err, pcre.ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestSubexpNames(t *testing.T) {
+	r := pcre.MustCompileOpts(`(?<a>x)(y)(?<b>z)|(?<a>w)`, pcre.DupNames)
+	defer r.Close()
+
+	expected := []string{"", "a", "", "b", "a"}
+	if !reflect.DeepEqual(r.SubexpNames(), expected) {
+		t.Errorf("expected %q, got %q", expected, r.SubexpNames())
+	}
+}
@@ -0,0 +1,105 @@
+package pcre
+
+// The methods in this file are variants of the matching methods that
+// return errors, such as exceeded limits or budgets, invalid UTF-8 with
+// the UTFReject policy, and ErrClosed, instead of panicking.
+
+// MatchErr is like Match, but returns an error instead of panicking
+func (r *Regexp) MatchErr(b []byte) (bool, error) {
+	matches, err := r.match(b, 0, false)
+	return len(matches) != 0, err
+}
+
+// MatchStringErr is the String version of MatchErr
+func (r *Regexp) MatchStringErr(s string) (bool, error) {
+	return r.MatchErr(stringBytes(s))
+}
+
+// FindIndexErr is like FindIndex, but returns an error instead of panicking
+func (r *Regexp) FindIndexErr(b []byte) ([]int, error) {
+	matches, err := r.match(b, 0, false)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	match := matches[0]
+
+	return []int{int(match[0]), int(match[1])}, nil
+}
+
+// FindStringIndexErr is the String version of FindIndexErr
+func (r *Regexp) FindStringIndexErr(s string) ([]int, error) {
+	return r.FindIndexErr(stringBytes(s))
+}
+
+// FindAllIndexErr is like FindAllIndex, but returns an
+// error instead of panicking
+func (r *Regexp) FindAllIndexErr(b []byte, n int) ([][]int, error) {
+	matches, err := r.match(b, 0, true)
+	if err != nil || len(matches) == 0 || n == 0 {
+		return nil, err
+	}
+	if n > 0 && len(matches) > n {
+		matches = matches[:n]
+	}
+
+	out := make([][]int, len(matches))
+	for index, match := range matches {
+		out[index] = []int{int(match[0]), int(match[1])}
+	}
+	return out, nil
+}
+
+// FindAllStringIndexErr is the String version of FindAllIndexErr
+func (r *Regexp) FindAllStringIndexErr(s string, n int) ([][]int, error) {
+	return r.FindAllIndexErr(stringBytes(s), n)
+}
+
+// FindSubmatchIndexErr is like FindSubmatchIndex, but returns
+// an error instead of panicking
+func (r *Regexp) FindSubmatchIndexErr(b []byte) ([]int, error) {
+	matches, err := r.match(b, 0, false)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	match := matches[0]
+
+	out := make([]int, len(match))
+	for index, offset := range match {
+		out[index] = int(offset)
+	}
+	return out, nil
+}
+
+// FindStringSubmatchIndexErr is the String version of FindSubmatchIndexErr
+func (r *Regexp) FindStringSubmatchIndexErr(s string) ([]int, error) {
+	return r.FindSubmatchIndexErr(stringBytes(s))
+}
+
+// FindAllSubmatchIndexErr is like FindAllSubmatchIndex, but
+// returns an error instead of panicking
+func (r *Regexp) FindAllSubmatchIndexErr(b []byte, n int) ([][]int, error) {
+	matches, err := r.match(b, 0, true)
+	if err != nil || len(matches) == 0 || n == 0 {
+		return nil, err
+	}
+	if n > 0 && len(matches) > n {
+		matches = matches[:n]
+	}
+
+	out := make([][]int, len(matches))
+	for index, match := range matches {
+		offsets := make([]int, len(match))
+
+		for index, offset := range match {
+			offsets[index] = int(offset)
+		}
+
+		out[index] = offsets
+	}
+	return out, nil
+}
+
+// FindAllStringSubmatchIndexErr is the String version of FindAllSubmatchIndexErr
+func (r *Regexp) FindAllStringSubmatchIndexErr(s string, n int) ([][]int, error) {
+	return r.FindAllSubmatchIndexErr(stringBytes(s), n)
+}
@@ -0,0 +1,294 @@
+package pcre
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+)
+
+// MemoryStats contains statistics about memory allocated by pcre2,
+// such as for compiled code, match data, and backtracking.
+type MemoryStats struct {
+	// InUse is the number of bytes currently allocated
+	InUse int64
+
+	// TotalAlloc is the number of bytes allocated,
+	// including ones that have since been freed.
+	TotalAlloc uint64
+
+	// Mallocs is the number of allocations
+	Mallocs uint64
+
+	// Frees is the number of allocations that have been freed
+	Frees uint64
+}
+
+// MemStats returns statistics about memory allocated by pcre2
+// for all regular expressions in this package.
+func MemStats() MemoryStats {
+	return globalMem.stats()
+}
+
+// MemStats returns statistics about memory allocated
+// by pcre2 for the regular expression.
+func (r *Regexp) MemStats() MemoryStats {
+	if err := r.acquire(); err != nil {
+		panic(err)
+	}
+	defer r.release()
+
+	return r.mem.stats()
+}
+
+// memAccount keeps track of memory allocated by pcre2.
+// Its counters are updated atomically.
+type memAccount struct {
+	inUse      int64
+	totalAlloc uint64
+	mallocs    uint64
+	frees      uint64
+
+	// budget limits the memory used by the expression, or is nil
+	budget *Budget
+	// ready is set once the expression is compiled. Memory allocated
+	// after that is match memory rather than pattern memory.
+	ready int32
+	// closed is set once the expression is closed
+	closed int32
+	// denied is set to the resource whose budget was
+	// exceeded, plus one, when an allocation is denied.
+	denied int32
+}
+
+// stats returns a snapshot of the account
+func (ma *memAccount) stats() MemoryStats {
+	return MemoryStats{
+		InUse:      atomic.LoadInt64(&ma.inUse),
+		TotalAlloc: atomic.LoadUint64(&ma.totalAlloc),
+		Mallocs:    atomic.LoadUint64(&ma.mallocs),
+		Frees:      atomic.LoadUint64(&ma.frees),
+	}
+}
+
+// alloc records an allocation of size bytes
+func (ma *memAccount) alloc(size int64) {
+	atomic.AddInt64(&ma.inUse, size)
+	atomic.AddUint64(&ma.totalAlloc, uint64(size))
+	atomic.AddUint64(&ma.mallocs, 1)
+}
+
+// free records that an allocation of size bytes was freed
+func (ma *memAccount) free(size int64) {
+	atomic.AddInt64(&ma.inUse, -size)
+	atomic.AddUint64(&ma.frees, 1)
+}
+
+// kind returns the budget resource used by new allocations
+func (ma *memAccount) kind() BudgetResource {
+	if atomic.LoadInt32(&ma.ready) != 0 {
+		return MatchMemory
+	}
+	return PatternMemory
+}
+
+// reserve reserves size bytes of the given resource in the
+// account's budget, if any. It reports whether that succeeded.
+func (ma *memAccount) reserve(res BudgetResource, size int64) bool {
+	if ma.budget == nil || ma.budget.reserve(res, size) {
+		return true
+	}
+	atomic.StoreInt32(&ma.denied, int32(res)+1)
+	return false
+}
+
+// release returns size bytes of the given resource to the
+// account's budget, if any.
+func (ma *memAccount) release(res BudgetResource, size int64) {
+	if ma.budget != nil {
+		ma.budget.release(res, size)
+	}
+}
+
+// deniedError returns a *BudgetError if an allocation was denied
+// since the last call, because the budget would have been exceeded.
+// Otherwise, it returns nil.
+func (ma *memAccount) deniedError() error {
+	denied := atomic.SwapInt32(&ma.denied, 0)
+	if denied == 0 {
+		return nil
+	}
+	return ma.budget.exceeded(BudgetResource(denied - 1))
+}
+
+var (
+	// globalMem accounts for allocations by all expressions
+	globalMem memAccount
+
+	// accounts maps the IDs passed to pcre2 as memory data to the
+	// accounts of open expressions. pcre2 only stores integers, so
+	// it can't refer to Go values directly.
+	accounts      sync.Map
+	lastAccountID uint64
+)
+
+// newAccount creates an account using the given budget,
+// which may be nil, and returns it with its ID.
+func newAccount(budget *Budget) (uintptr, *memAccount) {
+	id := uintptr(atomic.AddUint64(&lastAccountID, 1))
+	ma := &memAccount{budget: budget}
+	accounts.Store(id, ma)
+	return id, ma
+}
+
+// closeAccount marks the account with the given ID as closed. It's
+// removed once all of its memory is freed, as memory used by match
+// states that are still in use has to be returned to its budget.
+func closeAccount(id uintptr) {
+	ma := lookupAccount(id)
+	if ma == nil {
+		return
+	}
+	atomic.StoreInt32(&ma.closed, 1)
+	if atomic.LoadInt64(&ma.inUse) == 0 {
+		accounts.Delete(id)
+	}
+}
+
+// lookupAccount returns the account with the given ID, or nil
+func lookupAccount(id uintptr) *memAccount {
+	ma, ok := accounts.Load(id)
+	if !ok {
+		return nil
+	}
+	return ma.(*memAccount)
+}
+
+// allocHeaderSize is the size of the header stored before each block
+// allocated for pcre2. It contains the size of the block and the ID of
+// the account it was allocated for, so that frees are recorded in the
+// same account. It's large enough to keep blocks aligned for any type.
+const allocHeaderSize = 16
+
+// matchMemoryBit is set in the size stored in the
+// header of blocks that were allocated as match memory.
+const matchMemoryBit = 1 << 63
+
+// writeHeader stores the header of the block at p
+func writeHeader(p uintptr, size int64, id uintptr, kind BudgetResource) {
+	sizeField := uint64(size)
+	if kind == MatchMemory {
+		sizeField |= matchMemoryBit
+	}
+	*(*uint64)(unsafe.Pointer(p)) = sizeField
+	*(*uint64)(unsafe.Pointer(p + 8)) = uint64(id)
+}
+
+// readHeader returns the contents of the header of the block at p
+func readHeader(p uintptr) (size int64, id uintptr, kind BudgetResource) {
+	sizeField := *(*uint64)(unsafe.Pointer(p))
+	kind = PatternMemory
+	if sizeField&matchMemoryBit != 0 {
+		kind = MatchMemory
+	}
+	return int64(sizeField &^ matchMemoryBit), uintptr(*(*uint64)(unsafe.Pointer(p + 8))), kind
+}
+
+// accountedMalloc is the allocation function used by pcre2. The
+// memory data passed by pcre2 is the ID of the expression's account.
+// It fails if the allocation would exceed the account's budget.
+func accountedMalloc(tls *libc.TLS, size lib.Tsize_t, id uintptr) uintptr {
+	ma := lookupAccount(id)
+	kind := PatternMemory
+	if ma != nil {
+		kind = ma.kind()
+		if !ma.reserve(kind, int64(size)) {
+			return 0
+		}
+	}
+
+	p := libc.Xmalloc(tls, types.Size_t(size)+allocHeaderSize)
+	if p == 0 {
+		if ma != nil {
+			ma.release(kind, int64(size))
+		}
+		return 0
+	}
+	writeHeader(p, int64(size), id, kind)
+
+	globalMem.alloc(int64(size))
+	if ma != nil {
+		ma.alloc(int64(size))
+	}
+
+	return p + allocHeaderSize
+}
+
+// accountedFree is the function used by pcre2 to free
+// memory allocated by accountedMalloc.
+func accountedFree(tls *libc.TLS, block, _ uintptr) {
+	if block == 0 {
+		return
+	}
+
+	p := block - allocHeaderSize
+	size, id, kind := readHeader(p)
+
+	globalMem.free(size)
+	if ma := lookupAccount(id); ma != nil {
+		ma.free(size)
+		ma.release(kind, size)
+		if atomic.LoadInt32(&ma.closed) != 0 && atomic.LoadInt64(&ma.inUse) == 0 {
+			accounts.Delete(id)
+		}
+	}
+
+	libc.Xfree(tls, p)
+}
+
+// moveBlock records a block allocated by accountedMalloc, such as
+// compiled code copied from another expression, in the account with
+// the given ID, and makes pcre2 use that account for memory allocated
+// using the block's memory functions. The block must start with
+// pcre2's memory control structure, as contexts and compiled code do.
+//
+// moveBlock reports whether the block was moved. It isn't moved
+// if that would exceed the budget of the new account.
+func moveBlock(block, id uintptr) bool {
+	p := block - allocHeaderSize
+	size, oldID, oldKind := readHeader(p)
+
+	ma := lookupAccount(id)
+	kind := ma.kind()
+	if !ma.reserve(kind, size) {
+		return false
+	}
+	ma.alloc(size)
+
+	if oldMa := lookupAccount(oldID); oldMa != nil {
+		oldMa.free(size)
+		oldMa.release(oldKind, size)
+	}
+
+	writeHeader(p, size, id, kind)
+	(*lib.Tpcre2_memctl)(unsafe.Pointer(block)).Fmemory_data = id
+	return true
+}
+
+// newGeneralContext creates a general context that allocates memory
+// using accountedMalloc, for the account with the given ID. It returns
+// zero if the context can't be allocated.
+func newGeneralContext(tls *libc.TLS, id uintptr) uintptr {
+	mallocFn := *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, lib.Tsize_t, uintptr) uintptr
+	}{accountedMalloc}))
+	freeFn := *(*uintptr)(unsafe.Pointer(&struct {
+		f func(*libc.TLS, uintptr, uintptr)
+	}{accountedFree}))
+
+	return lib.Xpcre2_general_context_create_8(tls, mallocFn, freeFn, id)
+}
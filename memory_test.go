@@ -0,0 +1,94 @@
+package pcre_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestMemStats(t *testing.T) {
+	before := pcre.MemStats()
+
+	r := pcre.MustCompile(`(?<year>\d{4})-(?<month>\d{2})-(?<day>\d{2})`)
+	compiled := r.MemStats()
+	if compiled.InUse <= 0 || compiled.Mallocs == 0 {
+		t.Fatalf("expected compiled code to be recorded, got %+v", compiled)
+	}
+	if global := pcre.MemStats(); global.TotalAlloc-before.TotalAlloc < compiled.TotalAlloc {
+		t.Errorf("expected global allocations to include %d bytes, got %d", compiled.TotalAlloc, global.TotalAlloc-before.TotalAlloc)
+	}
+
+	// Matching allocates match data for the match state
+	r.MatchString("2023-01-02")
+	if matched := r.MemStats(); matched.InUse <= compiled.InUse {
+		t.Errorf("expected match state to be recorded, got %d bytes in use", matched.InUse)
+	}
+
+	// A clone has its own account, but needs as much
+	// memory for the compiled code as the original.
+	c := r.Clone()
+	if cloned := c.MemStats(); cloned.InUse < compiled.InUse || cloned.InUse == 0 {
+		t.Errorf("expected at least %d bytes in use by clone, got %d", compiled.InUse, cloned.InUse)
+	}
+	c.Close()
+
+	r.Close()
+	if after := pcre.MemStats(); after.InUse > before.InUse {
+		t.Errorf("expected all memory to be freed, got %d more bytes in use", after.InUse-before.InUse)
+	}
+}
+
+func TestMemStatsClose(t *testing.T) {
+	budget := &pcre.Budget{}
+	r, err := pcre.CompileWith(`a(b)c`, pcre.CompileConfig{Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled := r.MemStats().InUse
+
+	// Concurrent matches create several match states
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.MatchString("xabc")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Match data that isn't closed is freed with the expression
+	md := r.NewMatchData()
+	md.MatchString("abc")
+	if r.MemStats().InUse <= compiled {
+		t.Fatal("expected match states to be recorded")
+	}
+
+	r.Close()
+	if usage := budget.Usage(); usage != (pcre.BudgetUsage{}) {
+		t.Errorf("expected all memory to be freed, got %+v", usage)
+	}
+
+	// Closing the match data afterwards does nothing
+	md.Close()
+}
+
+func TestMemStatsBacktracking(t *testing.T) {
+	r := pcre.MustCompile(`(?:(a)|b)*c`)
+	defer r.Close()
+
+	// Create a match state, so that its allocations aren't counted
+	r.MatchString("c")
+
+	// Deep backtracking needs more memory than is available
+	// on the stack, so it's allocated by pcre2.
+	before := r.MemStats()
+	r.MatchString(strings.Repeat("ab", 10000) + "c")
+	if after := r.MemStats(); after.TotalAlloc <= before.TotalAlloc {
+		t.Errorf("expected backtracking memory to be recorded, got %+v", after)
+	}
+}
@@ -0,0 +1,127 @@
+package pcre
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// OffsetUnit is the unit in which an OffsetConverter reports offsets
+type OffsetUnit int
+
+const (
+	// ByteOffsets reports offsets in bytes, as the matching methods do
+	ByteOffsets OffsetUnit = iota
+	// RuneOffsets reports offsets in runes
+	RuneOffsets
+	// UTF16Offsets reports offsets in UTF-16 code units, as used
+	// by JavaScript and the Language Server Protocol.
+	UTF16Offsets
+)
+
+// String returns the name of the unit
+func (u OffsetUnit) String() string {
+	switch u {
+	case ByteOffsets:
+		return "bytes"
+	case RuneOffsets:
+		return "runes"
+	case UTF16Offsets:
+		return "UTF-16 code units"
+	default:
+		return fmt.Sprintf("OffsetUnit(%d)", int(u))
+	}
+}
+
+// OffsetConverter converts byte offsets into a UTF-8 subject, such as
+// the ones returned by FindIndex and FindAllSubmatchIndex, into rune or
+// UTF-16 offsets.
+//
+// The converter remembers the last offset it converted, and scans the
+// subject from there, so converting the indices of successive matches
+// only scans the subject once. Invalid UTF-8 bytes are counted as one
+// rune each, like the range statement does, and as one UTF-16 code
+// unit each, as they'd be replaced with U+FFFD. Offsets within a rune
+// are converted to the offset of that rune.
+//
+// An OffsetConverter is not safe for concurrent use.
+type OffsetConverter struct {
+	subject []byte
+	unit    OffsetUnit
+
+	// pos is the byte offset of the last
+	// conversion, and units is its result.
+	pos   int
+	units int
+}
+
+// NewOffsetConverter creates a converter for the given subject,
+// which must not be modified while the converter is in use.
+func NewOffsetConverter(subject []byte, unit OffsetUnit) *OffsetConverter {
+	return &OffsetConverter{subject: subject, unit: unit}
+}
+
+// NewOffsetConverterString creates a converter for the given subject
+func NewOffsetConverterString(subject string, unit OffsetUnit) *OffsetConverter {
+	return NewOffsetConverter(stringBytes(subject), unit)
+}
+
+// Offset converts a byte offset into the subject. Offsets
+// outside of the subject are limited to its bounds.
+func (oc *OffsetConverter) Offset(off int) int {
+	if oc.unit == ByteOffsets {
+		return off
+	}
+	if off < 0 {
+		off = 0
+	} else if off > len(oc.subject) {
+		off = len(oc.subject)
+	}
+
+	// Scan forward, stopping at the start of the rune containing off
+	for oc.pos < off {
+		r, size := utf8.DecodeRune(oc.subject[oc.pos:])
+		if oc.pos+size > off {
+			break
+		}
+		oc.pos += size
+		oc.units += oc.width(r)
+	}
+
+	// Scan backward to the start of the rune containing off
+	for oc.pos > off {
+		r, size := utf8.DecodeLastRune(oc.subject[:oc.pos])
+		oc.pos -= size
+		oc.units -= oc.width(r)
+	}
+
+	return oc.units
+}
+
+// Convert converts the byte offsets in idx in place, and returns
+// idx. Negative offsets, used for unmatched submatches, are kept.
+func (oc *OffsetConverter) Convert(idx []int) []int {
+	for i, off := range idx {
+		if off >= 0 {
+			idx[i] = oc.Offset(off)
+		}
+	}
+	return idx
+}
+
+// ConvertAll runs Convert on each element of all,
+// such as the result of FindAllSubmatchIndex.
+func (oc *OffsetConverter) ConvertAll(all [][]int) [][]int {
+	for _, idx := range all {
+		oc.Convert(idx)
+	}
+	return all
+}
+
+// width returns the number of units used by r
+func (oc *OffsetConverter) width(r rune) int {
+	if oc.unit == UTF16Offsets && r >= 0x10000 {
+		// Runes outside the BMP use a surrogate pair
+		return 2
+	}
+	return 1
+}
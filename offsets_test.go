@@ -0,0 +1,82 @@
+package pcre_test
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre"
+)
+
+func TestOffsetConverter(t *testing.T) {
+	r := pcre.MustCompileOpts(`(\w)(\w+)?`, pcre.UTF|pcre.UCP)
+	defer r.Close()
+
+	subject := "😀 ab é 𝄞x"
+	all := r.FindAllStringSubmatchIndex(subject, -1)
+
+	runes := pcre.NewOffsetConverterString(subject, pcre.RuneOffsets)
+	got := runes.ConvertAll(copyIndices(all))
+	expected := [][]int{{2, 4, 2, 3, 3, 4}, {5, 6, 5, 6, -1, -1}, {8, 9, 8, 9, -1, -1}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected rune offsets %v, got %v", expected, got)
+	}
+
+	units := pcre.NewOffsetConverterString(subject, pcre.UTF16Offsets)
+	got = units.ConvertAll(copyIndices(all))
+	expected = [][]int{{3, 5, 3, 4, 4, 5}, {6, 7, 6, 7, -1, -1}, {10, 11, 10, 11, -1, -1}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected UTF-16 offsets %v, got %v", expected, got)
+	}
+
+	bytes := pcre.NewOffsetConverterString(subject, pcre.ByteOffsets)
+	if got := bytes.ConvertAll(copyIndices(all)); !reflect.DeepEqual(got, all) {
+		t.Errorf("expected byte offsets to be unchanged, got %v", got)
+	}
+}
+
+func TestOffsetConverterOrder(t *testing.T) {
+	subject := []byte("a\xffé😀\xe2\x82b\xf0\x9f")
+
+	for _, unit := range []pcre.OffsetUnit{pcre.RuneOffsets, pcre.UTF16Offsets} {
+		oc := pcre.NewOffsetConverter(subject, unit)
+
+		// Convert offsets out of order, so that
+		// the subject is scanned in both directions.
+		for _, off := range []int{len(subject), 0, 8, 2, 12, 1, 9, 4, 11, 10} {
+			expected := bruteForceOffset(subject[:off], unit)
+			if got := oc.Offset(off); got != expected {
+				t.Errorf("%v: expected offset %d for byte %d, got %d", unit, expected, off, got)
+			}
+		}
+
+		// Offsets within a rune are converted to the offset of the rune
+		if got, expected := oc.Offset(6), oc.Offset(4); got != expected {
+			t.Errorf("%v: expected offset %d within rune, got %d", unit, expected, got)
+		}
+	}
+}
+
+// bruteForceOffset returns the length of b in the given unit
+func bruteForceOffset(b []byte, unit pcre.OffsetUnit) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		b = b[size:]
+		if unit == pcre.UTF16Offsets && r >= 0x10000 {
+			n += len(utf16.Encode([]rune{r}))
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func copyIndices(all [][]int) [][]int {
+	out := make([][]int, len(all))
+	for i, idx := range all {
+		out[i] = append([]int(nil), idx...)
+	}
+	return out
+}
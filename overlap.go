@@ -0,0 +1,187 @@
+package pcre
+
+import (
+	"runtime"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+)
+
+// initialEveryPairs is the initial number of offset pairs in the match
+// data used by FindEveryIndex. It is doubled when there are more matches
+// at a start position than fit.
+const initialEveryPairs = 32
+
+// FindAllOverlapping returns all matches of the regular expression,
+// including ones that overlap. After each match, the search restarts at
+// the character after the start of the match rather than at its end, so
+// at most one match is returned for each start position. For example,
+// `aa` has three matches in "aaaa". It will return no more than n matches.
+// If n < 0, it will return all matches. A return value of nil indicates
+// no match.
+func (r *Regexp) FindAllOverlapping(b []byte, n int) [][]byte {
+	matches := r.FindAllOverlappingIndex(b, n)
+	if matches == nil {
+		return nil
+	}
+
+	out := make([][]byte, len(matches))
+	for index, match := range matches {
+		out[index] = b[match[0]:match[1]]
+	}
+	return out
+}
+
+// FindAllOverlappingIndex is the index version of FindAllOverlapping
+func (r *Regexp) FindAllOverlappingIndex(b []byte, n int) [][]int {
+	matches, err := r.overlapping(b, n, false)
+	if err != nil {
+		panic(err)
+	}
+	return matches
+}
+
+// FindAllStringOverlapping is the String version of FindAllOverlapping
+func (r *Regexp) FindAllStringOverlapping(s string, n int) []string {
+	matches := r.FindAllOverlappingIndex([]byte(s), n)
+	if matches == nil {
+		return nil
+	}
+
+	out := make([]string, len(matches))
+	for index, match := range matches {
+		out[index] = s[match[0]:match[1]]
+	}
+	return out
+}
+
+// FindAllStringOverlappingIndex is the String version of FindAllOverlappingIndex
+func (r *Regexp) FindAllStringOverlappingIndex(s string, n int) [][]int {
+	return r.FindAllOverlappingIndex([]byte(s), n)
+}
+
+// FindEveryIndex is like FindAllOverlappingIndex, but returns every match
+// at each start position rather than only the preferred one. For example,
+// `a+` has the matches "aa" and "a" at the start of "aa", followed by "a"
+// at the second position. Matches at the same start position are ordered
+// from longest to shortest.
+//
+// pcre2 optimizes patterns by making quantifiers possessive where that
+// doesn't change the preferred match, which hides shorter matches, so
+// the expression should be compiled with the NoAutoPossess option.
+//
+// Matches are found using pcre2's DFA algorithm, so FindEveryIndex panics
+// if the pattern uses features the DFA algorithm doesn't support, such as
+// backreferences.
+func (r *Regexp) FindEveryIndex(b []byte, n int) [][]int {
+	matches, err := r.overlapping(b, n, true)
+	if err != nil {
+		panic(err)
+	}
+	return matches
+}
+
+// FindEveryStringIndex is the String version of FindEveryIndex
+func (r *Regexp) FindEveryStringIndex(s string, n int) [][]int {
+	return r.FindEveryIndex([]byte(s), n)
+}
+
+// overlapping finds up to n matches, restarting after the start of each
+// match. If every is set, every match at each start position is returned.
+func (r *Regexp) overlapping(b []byte, n int, every bool) ([][]int, error) {
+	if n == 0 {
+		return nil, nil
+	}
+
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	st, err := r.getState()
+	if err != nil {
+		return nil, err
+	}
+	defer r.putState(st)
+
+	b, skipped := r.skipInvalidUTF(b)
+
+	// Create a C pointer to the subject
+	cSubject := subjectPointer(b)
+	cSubjectLen := lib.Tsize_t(len(b))
+
+	// The DFA algorithm needs a pair for each match at a start
+	// position, so it uses its own match data.
+	md := st.md
+	pairs := uint32(initialEveryPairs)
+	var gctx uintptr
+	if every {
+		// The match data is allocated using the expression's
+		// memory account, so that it's recorded in its budget.
+		gctx = newGeneralContext(st.tls, r.memID)
+		if gctx == 0 {
+			return nil, r.matchError(st.tls, md, lib.DPCRE2_ERROR_NOMEMORY)
+		}
+		defer lib.Xpcre2_general_context_free_8(st.tls, gctx)
+
+		md = lib.Xpcre2_match_data_create_8(st.tls, pairs, gctx)
+		if md == 0 {
+			return nil, r.matchError(st.tls, md, lib.DPCRE2_ERROR_NOMEMORY)
+		}
+		// Free the match data at the end of the function. It's
+		// looked up when freeing as it may be replaced.
+		defer func() { lib.Xpcre2_match_data_free_8(st.tls, md) }()
+	}
+
+	var out [][]int
+	var offset lib.Tsize_t
+	for offset <= cSubjectLen && (n < 0 || len(out) < n) {
+		var ret int32
+		if every {
+			ret = r.dfaExec(st, cSubject, cSubjectLen, offset, 0, md)
+		} else {
+			ret = r.exec(st, cSubject, cSubjectLen, offset, 0, md)
+		}
+		if ret == lib.DPCRE2_ERROR_NOMATCH {
+			break
+		} else if ret < 0 {
+			return nil, r.matchError(st.tls, md, ret)
+		}
+
+		// A return value of zero from the DFA algorithm means that
+		// there were more matches than pairs in the match data.
+		if every && ret == 0 {
+			lib.Xpcre2_match_data_free_8(st.tls, md)
+			pairs *= 2
+			md = lib.Xpcre2_match_data_create_8(st.tls, pairs, gctx)
+			if md == 0 {
+				return nil, r.matchError(st.tls, md, lib.DPCRE2_ERROR_NOMEMORY)
+			}
+			continue
+		}
+
+		ovec := lib.Xpcre2_get_ovector_pointer_8(st.tls, md)
+		slice := unsafe.Slice((*lib.Tsize_t)(unsafe.Pointer(ovec)), lib.Xpcre2_get_ovector_count_8(st.tls, md)*2)
+
+		count := 1
+		if every {
+			count = int(ret)
+		}
+		for i := 0; i < count && (n < 0 || len(out) < n); i++ {
+			out = append(out, []int{int(slice[2*i]), int(slice[2*i+1])})
+		}
+
+		// Restart at the character after the start of the match
+		next := nextChar(b, slice[0], r.utf)
+		if next <= offset {
+			next = nextChar(b, offset, r.utf)
+		}
+		offset = next
+	}
+
+	runtime.KeepAlive(b)
+	for _, match := range out {
+		skipped.remap(match)
+	}
+	return out, nil
+}
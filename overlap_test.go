@@ -0,0 +1,95 @@
+package pcre_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestFindAllOverlapping(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		options  pcre.CompileOption
+		subject  string
+		n        int
+		expected [][]int
+	}{
+		{`aa`, 0, "aaaa", -1, [][]int{{0, 2}, {1, 3}, {2, 4}}},
+		{`aa`, 0, "aaaa", 2, [][]int{{0, 2}, {1, 3}}},
+		{`a.a`, 0, "abaca", -1, [][]int{{0, 3}, {2, 5}}},
+		{`\w+`, 0, "ab c", -1, [][]int{{0, 2}, {1, 2}, {3, 4}}},
+		{`x*`, 0, "ab", -1, [][]int{{0, 0}, {1, 1}, {2, 2}}},
+		{`(?=(\w\w))`, 0, "abc", -1, [][]int{{0, 0}, {1, 1}}},
+		{`é.`, pcre.UTF, "ééé", -1, [][]int{{0, 4}, {2, 6}}},
+		{`TATA`, 0, "GTATATAG", -1, [][]int{{1, 5}, {3, 7}}},
+		{`x`, 0, "abc", -1, nil},
+	}
+
+	for _, test := range tests {
+		r := pcre.MustCompileOpts(test.pattern, test.options)
+
+		got := r.FindAllStringOverlappingIndex(test.subject, test.n)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.pattern, test.expected, got)
+		}
+
+		r.Close()
+	}
+
+	r := pcre.MustCompile(`\d\d`)
+	defer r.Close()
+
+	expected := []string{"12", "23", "34"}
+	if got := r.FindAllStringOverlapping("1234", -1); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if got := r.FindAllOverlapping([]byte("1"), -1); got != nil {
+		t.Errorf("expected nil, got %q", got)
+	}
+}
+
+func TestFindEveryIndex(t *testing.T) {
+	r := pcre.MustCompileOpts(`a+|ab`, pcre.NoAutoPossess)
+	defer r.Close()
+
+	expected := [][]int{{0, 2}, {0, 1}, {1, 3}, {1, 2}}
+	if got := r.FindEveryStringIndex("aab", -1); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := r.FindEveryStringIndex("aab", 3); !reflect.DeepEqual(got, expected[:3]) {
+		t.Errorf("expected %v, got %v", expected[:3], got)
+	}
+
+	// Automatic possessification hides shorter matches
+	r = pcre.MustCompile(`a+`)
+	defer r.Close()
+
+	expected = [][]int{{0, 2}, {1, 2}}
+	if got := r.FindEveryStringIndex("aa", -1); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// More matches at a start position than fit in the initial match data
+	r = pcre.MustCompileOpts(`a+`, pcre.NoAutoPossess)
+	defer r.Close()
+
+	subject := make([]byte, 100)
+	for i := range subject {
+		subject[i] = 'a'
+	}
+	if got := r.FindEveryIndex(subject, -1); len(got) != 100*101/2 {
+		t.Errorf("expected %d matches, got %d", 100*101/2, len(got))
+	}
+
+	r = pcre.MustCompile(`(a)\1`)
+	defer r.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for backreference")
+		}
+	}()
+	r.FindEveryStringIndex("aa", -1)
+}
@@ -8,11 +8,13 @@
 package pcre
 
 import (
+	"context"
+	"errors"
 	"math"
-	"os"
 	"runtime"
-	"strconv"
 	"sync"
+	"sync/atomic"
+	"unicode/utf8"
 	"unsafe"
 
 	"go.elara.ws/pcre/lib"
@@ -22,19 +24,49 @@ import (
 
 const Unset = math.MaxUint
 
+// ErrClosed is returned, or used as the panic value for methods that
+// panic on errors, when a closed regular expression is used.
+var ErrClosed = errors.New("regular expression is closed")
+
 // Version returns the version of pcre2 embedded in this library.
 func Version() string { return lib.DPACKAGE_VERSION }
 
-// Regexp represents a pcre2 regular expression
+// Regexp represents a pcre2 regular expression.
+//
+// A Regexp is safe for concurrent use by multiple goroutines. The
+// compiled code is shared, while each concurrent match uses its own
+// match state from a pool, so matching doesn't block other matches.
 type Regexp struct {
+	// mtx protects the match context and thread-local storage,
+	// but is not held while matching.
 	mtx  *sync.Mutex
+	life *lifecycle
 	expr string
+	opts CompileOption
 	re   uintptr
 	mctx uintptr
 	tls  *libc.TLS
+	utf  bool
+
+	mem   *memAccount
+	memID uintptr
+
+	states  *statePool
+	version *uint64
+
+	longest bool
+	owner   *Regexp
 
-	calloutMtx *sync.Mutex
-	callout    *func(tls *libc.TLS, cbptr, data uintptr) int32
+	utfPolicy UTFPolicy
+
+	// config is the configuration the expression was compiled with,
+	// used to compile variants of it. Its recursion guard and context
+	// are removed, as they only apply to the original compilation.
+	// The code refers to its tables, which are kept alive for as
+	// long as the expression.
+	config CompileConfig
+
+	callout *func(tls *libc.TLS, cbptr, data uintptr) int32
 }
 
 // Compile runs CompileOpts with no options.
@@ -50,12 +82,77 @@ func Compile(pattern string) (*Regexp, error) {
 // Close() should be called on the returned expression
 // once it is no longer needed.
 func CompileOpts(pattern string, options CompileOption) (*Regexp, error) {
+	return CompileWith(pattern, CompileConfig{Options: options})
+}
+
+// CompileConfig contains the settings used by CompileWith
+type CompileConfig struct {
+	// Options contains the compile options
+	Options CompileOption
+
+	// Budget limits the resources used by the expression
+	// together with others compiled with the same budget.
+	// If it's nil, the resources are not limited.
+	Budget *Budget
+
+	// Tables contains the character tables used when UTF mode
+	// is not enabled. If it's nil, the C locale tables are used.
+	Tables *Tables
+
+	// RecursionGuard is called with the nesting depth of parentheses
+	// each time a group in the pattern is compiled. If it returns an
+	// error, compilation is aborted and CompileWith returns a *GuardError
+	// wrapping it. It may be nil.
+	RecursionGuard func(depth int) error
+
+	// Context cancels compilation once it's done, which is checked
+	// before compiling and each time a group in the pattern is compiled.
+	// CompileWith then returns a *GuardError wrapping the context's
+	// error. It may be nil.
+	Context context.Context
+
+	// UTFPolicy determines how subjects containing invalid UTF-8
+	// are handled if the expression is compiled in UTF mode.
+	UTFPolicy UTFPolicy
+}
+
+// CompileWith compiles the provided pattern using the given config.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func CompileWith(pattern string, config CompileConfig) (*Regexp, error) {
+	if config.Context != nil {
+		if err := config.Context.Err(); err != nil {
+			return nil, &GuardError{Err: err}
+		}
+	}
+
+	budget := config.Budget
+	if budget != nil && !budget.reserve(LiveRegexps, 1) {
+		return nil, budget.exceeded(LiveRegexps)
+	}
+
 	tls := libc.NewTLS()
+	memID, mem := newAccount(budget)
+
+	// failed releases the expression's resources
+	// if it can't be created, and returns err.
+	failed := func(err error) (*Regexp, error) {
+		if budgetErr := mem.deniedError(); budgetErr != nil {
+			err = budgetErr
+		}
+		closeAccount(memID)
+		if budget != nil {
+			budget.release(LiveRegexps, 1)
+		}
+		tls.Close()
+		return nil, err
+	}
 
 	// Get C string of pattern
 	cPattern, err := libc.CString(pattern)
 	if err != nil {
-		return nil, err
+		return failed(err)
 	}
 	// Free the string when done
 	defer libc.Xfree(tls, cPattern)
@@ -72,20 +169,189 @@ func CompileOpts(pattern string, options CompileOption) (*Regexp, error) {
 	// Convert pattern length to size_t type
 	cPatLen := lib.Tsize_t(len(pattern))
 
+	// Create contexts that allocate memory
+	// using the expression's memory account.
+	gctx := newGeneralContext(tls, memID)
+	defer lib.Xpcre2_general_context_free_8(tls, gctx)
+	var cctx uintptr
+	if gctx != 0 {
+		cctx = lib.Xpcre2_compile_context_create_8(tls, gctx)
+	}
+	defer lib.Xpcre2_compile_context_free_8(tls, cctx)
+
+	if gctx == 0 || cctx == 0 {
+		return failed(codeToError(tls, lib.DPCRE2_ERROR_NOMEMORY))
+	}
+	if config.Tables != nil {
+		lib.Xpcre2_set_character_tables_8(tls, cctx, config.Tables.ptr())
+	}
+	guardDone := setCompileGuard(tls, cctx, config)
+
+	options := config.Options
+	if config.UTFPolicy == UTFNoMatch && options&UTF != 0 {
+		// MatchInvalidUTF implies UTF, so it's only
+		// added to expressions compiled in UTF mode.
+		options |= MatchInvalidUTF
+	}
+
 	// Compile expression
-	r := lib.Xpcre2_compile_8(tls, cPattern, cPatLen, uint32(options), errPtr, errOffsetPtr, 0)
+	r := lib.Xpcre2_compile_8(tls, cPattern, cPatLen, uint32(options), errPtr, errOffsetPtr, cctx)
+	if r != 0 && config.UTFPolicy == UTFNoMatch && options&MatchInvalidUTF == 0 {
+		// The pattern may enable UTF itself, such as with (*UTF),
+		// in which case it's compiled again with MatchInvalidUTF.
+		var allOptions uint32
+		lib.Xpcre2_pattern_info_8(tls, r, lib.DPCRE2_INFO_ALLOPTIONS, uintptr(unsafe.Pointer(&allOptions)))
+		if allOptions&lib.DPCRE2_UTF != 0 {
+			lib.Xpcre2_code_free_8(tls, r)
+			options |= MatchInvalidUTF
+			r = lib.Xpcre2_compile_8(tls, cPattern, cPatLen, uint32(options), errPtr, errOffsetPtr, cctx)
+		}
+	}
+	guardErr := guardDone()
 	if r == 0 {
-		return nil, ptrToError(tls, cErr)
+		if guardErr != nil {
+			return failed(guardErr)
+		}
+		return failed(ptrToError(tls, cErr))
+	}
+
+	mctx := lib.Xpcre2_match_context_create_8(tls, gctx)
+	if mctx == 0 {
+		lib.Xpcre2_code_free_8(tls, r)
+		return failed(codeToError(tls, lib.DPCRE2_ERROR_NOMEMORY))
 	}
+	// Memory allocated from now on is used for matching
+	atomic.StoreInt32(&mem.ready, 1)
+
+	// The guard and context only apply to this compilation
+	config.RecursionGuard, config.Context = nil, nil
 
 	// Create regexp instance
 	regex := Regexp{
-		expr:       pattern,
-		mtx:        &sync.Mutex{},
-		re:         r,
-		mctx:       lib.Xpcre2_match_context_create_8(tls, 0),
-		tls:        tls,
-		calloutMtx: &sync.Mutex{},
+		expr:    pattern,
+		opts:    config.Options,
+		mtx:     &sync.Mutex{},
+		life:    &lifecycle{},
+		re:      r,
+		mctx:    mctx,
+		tls:     tls,
+		states:  newStatePool(),
+		version: new(uint64),
+		mem:     mem,
+		memID:   memID,
+		config:  config,
+
+		utfPolicy: config.UTFPolicy,
+	}
+	if options&MatchInvalidUTF != 0 {
+		regex.utfPolicy = UTFNoMatch
+	}
+	regex.utf = regex.patternInfo(lib.DPCRE2_INFO_ALLOPTIONS)&lib.DPCRE2_UTF != 0
+
+	// Make sure resources are freed if GC collects the
+	// regular expression.
+	runtime.SetFinalizer(&regex, func(r *Regexp) error {
+		return r.Close()
+	})
+
+	return &regex, nil
+}
+
+// Clone returns a copy of the regular expression that shares no state
+// with r, without compiling the pattern again. The copy starts with the
+// same callout, limits, and Longest setting as r, which can then be
+// changed independently of r.
+//
+// If r was compiled with a Budget, the copy uses the same budget, and
+// Clone panics with a *BudgetError if the budget would be exceeded.
+// CloneErr returns the error instead.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func (r *Regexp) Clone() *Regexp {
+	regex, err := r.CloneErr()
+	if err != nil {
+		panic(err)
+	}
+	return regex
+}
+
+// CloneErr is like Clone, but returns an error instead of panicking
+// if r is closed, the budget would be exceeded, or memory can't be
+// allocated for the copy.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func (r *Regexp) CloneErr() (*Regexp, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	budget := r.mem.budget
+	if budget != nil && !budget.reserve(LiveRegexps, 1) {
+		return nil, budget.exceeded(LiveRegexps)
+	}
+
+	tls := libc.NewTLS()
+
+	// failed releases the copy's resources
+	// if it can't be created, and returns err.
+	var re, mctx, memID uintptr
+	failed := func(err error) (*Regexp, error) {
+		lib.Xpcre2_code_free_8(tls, re)
+		lib.Xpcre2_match_context_free_8(tls, mctx)
+		if memID != 0 {
+			closeAccount(memID)
+		}
+		if budget != nil {
+			budget.release(LiveRegexps, 1)
+		}
+		tls.Close()
+		return nil, err
+	}
+
+	// The copies are allocated using r's memory account
+	re = lib.Xpcre2_code_copy_8(tls, r.re)
+	if re == 0 {
+		return failed(r.matchError(tls, 0, lib.DPCRE2_ERROR_NOMEMORY))
+	}
+	mctx = lib.Xpcre2_match_context_copy_8(tls, r.mctx)
+	if mctx == 0 {
+		return failed(r.matchError(tls, 0, lib.DPCRE2_ERROR_NOMEMORY))
+	}
+
+	// The copies use the memory functions of the originals,
+	// so they're moved to the copy's own memory account.
+	memID, mem := newAccount(budget)
+	if !moveBlock(re, memID) || !moveBlock(mctx, memID) {
+		return failed(mem.deniedError())
+	}
+	atomic.StoreInt32(&mem.ready, 1)
+
+	regex := Regexp{
+		expr:    r.expr,
+		opts:    r.opts,
+		mtx:     &sync.Mutex{},
+		life:    &lifecycle{},
+		re:      re,
+		mctx:    mctx,
+		tls:     tls,
+		utf:     r.utf,
+		states:  newStatePool(),
+		version: new(uint64),
+		longest: r.longest,
+		mem:     mem,
+		memID:   memID,
+		// The copied match context refers to the callout function,
+		// so the copy has to keep it alive as well.
+		callout: r.callout,
+		// The copied code refers to the same tables
+		config:    r.config,
+		utfPolicy: r.utfPolicy,
 	}
 
 	// Make sure resources are freed if GC collects the
@@ -141,16 +407,11 @@ func (r *Regexp) Find(b []byte) []byte {
 // representing the location of the leftmost match of the
 // regular expression.
 func (r *Regexp) FindIndex(b []byte) []int {
-	matches, err := r.match(b, 0, false)
+	match, err := r.FindIndexErr(b)
 	if err != nil {
 		panic(err)
 	}
-	if len(matches) == 0 {
-		return nil
-	}
-	match := matches[0]
-
-	return []int{int(match[0]), int(match[1])}
+	return match
 }
 
 // FindAll returns all matches of the regular expression.
@@ -179,22 +440,11 @@ func (r *Regexp) FindAll(b []byte, n int) [][]byte {
 // regular expression. A return value of nil indicates
 // no match.
 func (r *Regexp) FindAllIndex(b []byte, n int) [][]int {
-	matches, err := r.match(b, 0, true)
+	matches, err := r.FindAllIndexErr(b, n)
 	if err != nil {
 		panic(err)
 	}
-	if len(matches) == 0 || n == 0 {
-		return nil
-	}
-	if n > 0 && len(matches) > n {
-		matches = matches[:n]
-	}
-
-	out := make([][]int, len(matches))
-	for index, match := range matches {
-		out[index] = []int{int(match[0]), int(match[1])}
-	}
-	return out
+	return matches
 }
 
 // FindSubmatch returns a slice containing the match as the
@@ -223,21 +473,11 @@ func (r *Regexp) FindSubmatch(b []byte) [][]byte {
 // FindSubmatchIndex returns a slice of index pairs representing
 // the match and submatches, if any.
 func (r *Regexp) FindSubmatchIndex(b []byte) []int {
-	matches, err := r.match(b, 0, false)
+	match, err := r.FindSubmatchIndexErr(b)
 	if err != nil {
 		panic(err)
 	}
-	if len(matches) == 0 {
-		return nil
-	}
-	match := matches[0]
-
-	out := make([]int, len(match))
-	for index, offset := range match {
-		out[index] = int(offset)
-	}
-
-	return out
+	return match
 }
 
 // FindAllSubmatch returns a slice of all matches and submatches
@@ -277,29 +517,11 @@ func (r *Regexp) FindAllSubmatch(b []byte, n int) [][][]byte {
 // locations of matches and submatches, if any, of the regular expression.
 // It will return no more than n matches. If n < 0, it will return all matches.
 func (r *Regexp) FindAllSubmatchIndex(b []byte, n int) [][]int {
-	matches, err := r.match(b, 0, true)
+	matches, err := r.FindAllSubmatchIndexErr(b, n)
 	if err != nil {
 		panic(err)
 	}
-	if len(matches) == 0 || n == 0 {
-		return nil
-	}
-	if n > 0 && len(matches) > n {
-		matches = matches[:n]
-	}
-
-	out := make([][]int, len(matches))
-	for index, match := range matches {
-		offsets := make([]int, len(match))
-
-		for index, offset := range match {
-			offsets[index] = int(offset)
-		}
-
-		out[index] = offsets
-	}
-
-	return out
+	return matches
 }
 
 // FindString is the String version of Find
@@ -315,6 +537,9 @@ func (r *Regexp) FindStringIndex(s string) []int {
 // FinAllString is the String version of FindAll
 func (r *Regexp) FindAllString(s string, n int) []string {
 	matches := r.FindAll([]byte(s), n)
+	if matches == nil {
+		return nil
+	}
 
 	out := make([]string, len(matches))
 	for index, match := range matches {
@@ -331,6 +556,9 @@ func (r *Regexp) FindAllStringIndex(s string, n int) [][]int {
 // FindStringSubmatch is the string version of FindSubmatch
 func (r *Regexp) FindStringSubmatch(s string) []string {
 	matches := r.FindSubmatch([]byte(s))
+	if matches == nil {
+		return nil
+	}
 
 	out := make([]string, len(matches))
 	for index, match := range matches {
@@ -347,6 +575,9 @@ func (r *Regexp) FindStringSubmatchIndex(s string) []int {
 // FindAllStringSubmatch is the String version of FindAllSubmatch
 func (r *Regexp) FindAllStringSubmatch(s string, n int) [][]string {
 	matches := r.FindAllSubmatch([]byte(s), n)
+	if matches == nil {
+		return nil
+	}
 
 	out := make([][]string, len(matches))
 	for index, match := range matches {
@@ -369,17 +600,26 @@ func (r *Regexp) FindAllStringSubmatchIndex(s string, n int) [][]int {
 
 // Match reports whether b contains a match of the regular expression
 func (r *Regexp) Match(b []byte) bool {
-	return r.Find(b) != nil
+	matched, err := r.MatchErr(b)
+	if err != nil {
+		panic(err)
+	}
+	return matched
 }
 
 // MatchString is the String version of Match
 func (r *Regexp) MatchString(s string) bool {
-	return r.Find([]byte(s)) != nil
+	return r.Match([]byte(s))
 }
 
 // NumSubexp returns the number of parenthesized subexpressions
 // in the regular expression.
 func (r *Regexp) NumSubexp() int {
+	if err := r.acquire(); err != nil {
+		panic(err)
+	}
+	defer r.release()
+
 	return int(r.patternInfo(lib.DPCRE2_INFO_CAPTURECOUNT))
 }
 
@@ -401,30 +641,22 @@ func (r *Regexp) ReplaceAll(src, repl []byte) []byte {
 	out := make([]byte, len(src))
 	copy(out, src)
 
+	names := r.SubexpNames()
+	indices := make([]int, 0, len(matches[0]))
+
 	var diff int64
+	var replStr []byte
 	for _, match := range matches {
-		replStr := os.Expand(string(repl), func(s string) string {
-			i, err := strconv.Atoi(s)
-			if err != nil {
-				i = r.SubexpIndex(s)
-				if i == -1 {
-					return ""
-				}
-			}
-
-			// If there given match does not exist, return empty string
-			if i == 0 || len(match) < (2*i)+1 {
-				return ""
-			}
+		indices = indices[:0]
+		for _, offset := range match {
+			indices = append(indices, int(offset))
+		}
 
-			// Return match
-			return string(src[match[2*i]:match[(2*i)+1]])
-		})
-		// Replace replacement string with expanded string
-		repl := []byte(replStr)
+		// Expand the template for this match
+		replStr = expand(replStr[:0], string(repl), src, "", indices, names)
 
 		// Replace bytes with new replacement string
-		diff, out = replaceBytes(out, repl, match[0], match[1], diff)
+		diff, out = replaceBytes(out, replStr, match[0], match[1], diff)
 	}
 
 	return out
@@ -552,6 +784,11 @@ func (r *Regexp) String() string {
 // with the given name, or -1 if there is no subexpression
 // with that name.
 func (r *Regexp) SubexpIndex(name string) int {
+	if err := r.acquire(); err != nil {
+		panic(err)
+	}
+	defer r.release()
+
 	r.mtx.Lock()
 	defer r.mtx.Unlock()
 
@@ -576,6 +813,43 @@ func (r *Regexp) SubexpIndex(name string) int {
 	return int(ret)
 }
 
+// SubexpNames returns the names of the parenthesized subexpressions
+// in this Regexp. The name for the first sub-expression is names[1],
+// so that if m is a match slice, the name for m[i] is SubexpNames()[i].
+// Since the Regexp as a whole cannot be named, names[0] is always
+// the empty string.
+func (r *Regexp) SubexpNames() []string {
+	if err := r.acquire(); err != nil {
+		panic(err)
+	}
+	defer r.release()
+
+	names := make([]string, r.patternInfo(lib.DPCRE2_INFO_CAPTURECOUNT)+1)
+
+	count := r.patternInfo(lib.DPCRE2_INFO_NAMECOUNT)
+	if count == 0 {
+		return names
+	}
+	entrySize := uintptr(r.patternInfo(lib.DPCRE2_INFO_NAMEENTRYSIZE))
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	// Get a pointer to the name table
+	var table uintptr
+	lib.Xpcre2_pattern_info_8(r.tls, r.re, lib.DPCRE2_INFO_NAMETABLE, uintptr(unsafe.Pointer(&table)))
+
+	// Each entry contains the group number as a big-endian
+	// 16-bit integer, followed by the zero-terminated name.
+	for i := uintptr(0); i < uintptr(count); i++ {
+		entry := unsafe.Slice((*byte)(unsafe.Pointer(table+i*entrySize)), entrySize)
+		index := int(entry[0])<<8 | int(entry[1])
+		names[index] = libc.GoString(table + i*entrySize + 2)
+	}
+
+	return names
+}
+
 // SetCallout sets a callout function that will be called at specified points in the matching operation.
 // fn should return zero if it ran successfully or a non-zero integer to force an error.
 // See https://www.pcre.org/current/doc/html/pcre2callout.html for more information.
@@ -618,8 +892,13 @@ func (r *Regexp) SetCallout(fn func(cb *CalloutBlock) int32) error {
 		return fn(cb)
 	}
 
-	r.calloutMtx.Lock()
-	defer r.calloutMtx.Unlock()
+	if err := r.acquire(); err != nil {
+		return err
+	}
+	defer r.release()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
 
 	// Prevent callout function from being GC'd
 	r.callout = &cfn
@@ -628,6 +907,47 @@ func (r *Regexp) SetCallout(fn func(cb *CalloutBlock) int32) error {
 	if ret < 0 {
 		return codeToError(r.tls, ret)
 	}
+	r.configChanged()
+	return nil
+}
+
+// SetMatchLimit sets the maximum amount of times pcre2's internal match
+// function may be called during a single match. If the limit is exceeded,
+// matching fails with an error.
+// See https://www.pcre.org/current/doc/html/pcre2api.html#SEC21 for more information.
+func (r *Regexp) SetMatchLimit(limit uint32) error {
+	return r.setLimit(lib.Xpcre2_set_match_limit_8, limit)
+}
+
+// SetDepthLimit sets the maximum depth of nested backtracking
+// during a single match. If the limit is exceeded, matching
+// fails with an error.
+func (r *Regexp) SetDepthLimit(limit uint32) error {
+	return r.setLimit(lib.Xpcre2_set_depth_limit_8, limit)
+}
+
+// SetHeapLimit sets the maximum amount of heap memory, in kibibytes,
+// that may be used to store backtracking information during a single
+// match. If the limit is exceeded, matching fails with an error.
+func (r *Regexp) SetHeapLimit(limit uint32) error {
+	return r.setLimit(lib.Xpcre2_set_heap_limit_8, limit)
+}
+
+// setLimit sets a limit in the match context using the given function
+func (r *Regexp) setLimit(set func(tls *libc.TLS, mctx uintptr, limit uint32) int32, limit uint32) error {
+	if err := r.acquire(); err != nil {
+		return err
+	}
+	defer r.release()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	ret := set(r.tls, r.mctx, limit)
+	if ret < 0 {
+		return codeToError(r.tls, ret)
+	}
+	r.configChanged()
 	return nil
 }
 
@@ -646,84 +966,203 @@ func replaceBytes(src, repl []byte, sOff, eOff lib.Tsize_t, diff int64) (int64,
 	return diff + int64(len(out)-len(src)), out
 }
 
+// emptySubject is used as the subject pointer for empty subjects
+var emptySubject byte
+
+// subjectPointer returns a C pointer to the subject. The caller
+// must keep b alive while the pointer is in use.
+func subjectPointer(b []byte) uintptr {
+	if len(b) == 0 {
+		return uintptr(unsafe.Pointer(&emptySubject))
+	}
+	return uintptr(unsafe.Pointer(&b[0]))
+}
+
 // match calls the underlying pcre match functions. It re-runs the functions
 // until no matches are found if multi is set to true.
+//
+// Successive matches follow the same rules as Go's regexp package: an
+// empty match immediately after a previous match is ignored, and after
+// an empty match, the search continues at the next character.
 func (r *Regexp) match(b []byte, options uint32, multi bool) ([][]lib.Tsize_t, error) {
-	if len(b) == 0 {
-		return nil, nil
+	if err := r.acquire(); err != nil {
+		return nil, err
 	}
+	defer r.release()
 
-	r.mtx.Lock()
-	defer r.mtx.Unlock()
+	st, err := r.getState()
+	if err != nil {
+		return nil, err
+	}
+	defer r.putState(st)
+
+	b, skipped := r.skipInvalidUTF(b)
 
 	// Create a C pointer to the subject
-	sp := unsafe.Pointer(&b[0])
-	cSubject := uintptr(sp)
+	cSubject := subjectPointer(b)
 	// Convert the size of the subject to a C size_t type
 	cSubjectLen := lib.Tsize_t(len(b))
 
-	// Create match data using the pattern to figure out the buffer size
-	md := lib.Xpcre2_match_data_create_from_pattern_8(r.tls, r.re, 0)
-	if md == 0 {
-		panic("error creating match data")
-	}
-	// Free the match data at the end of the function
-	defer lib.Xpcre2_match_data_free_8(r.tls, md)
-
 	var offset lib.Tsize_t
 	var out [][]lib.Tsize_t
-	// While the offset is less than the length of the subject
-	for offset < cSubjectLen {
+	prevEnd := lib.Tsize_t(Unset)
+	// While the offset is within the subject
+	for offset <= cSubjectLen {
 		// Execute expression on subject
-		ret := lib.Xpcre2_match_8(r.tls, r.re, cSubject, cSubjectLen, offset, options, md, r.mctx)
+		ret := r.exec(st, cSubject, cSubjectLen, offset, options, st.md)
 		if ret < 0 {
 			// If no match found, break
 			if ret == lib.DPCRE2_ERROR_NOMATCH {
 				break
 			}
 
-			return nil, codeToError(r.tls, ret)
-		} else {
-			// Get amount of pairs in output vector
-			pairAmt := lib.Xpcre2_get_ovector_count_8(r.tls, md)
-			// Get pointer to output vector
-			ovec := lib.Xpcre2_get_ovector_pointer_8(r.tls, md)
-			// Create a Go slice using the output vector as the underlying array
-			slice := unsafe.Slice((*lib.Tsize_t)(unsafe.Pointer(ovec)), pairAmt*2)
-
-			// Create a new slice and copy the elements from the slice
-			// This is required because the match data will be freed in
-			// a defer, and that would cause a panic every time the slice
-			// is used later.
-			matches := make([]lib.Tsize_t, len(slice))
-			copy(matches, slice)
-
-			// If the two indices are the same (empty string), and the match is not
-			// immediately after another match, add it to the output and increment the
-			// offset. Otherwise, increment the offset and ignore the match.
-			if slice[0] == slice[1] && len(out) > 0 && slice[0] != out[len(out)-1][1] {
-				out = append(out, matches)
-				offset = slice[1] + 1
-				continue
-			} else if slice[0] == slice[1] {
-				offset = slice[1] + 1
-				continue
-			}
+			return nil, r.matchError(st.tls, st.md, ret)
+		}
+
+		// The output vector of the match data
+		slice := st.ovec
+
+		var accept bool
+		accept, offset, prevEnd = nextMatch(b, slice, offset, prevEnd, r.utf)
+		if !accept {
+			continue
+		}
 
-			// Add the match to the output
-			out = append(out, matches)
-			// Set the next offset to the end index of the match
-			offset = matches[1]
+		// Create a new slice and copy the elements from the slice
+		// This is required because the match data will be reused
+		// by later matches once it's returned to the pool.
+		matches := make([]lib.Tsize_t, len(slice))
+		copy(matches, slice)
+		if skipped.offsets != nil {
+			for i := 0; i < len(matches); i += 2 {
+				if matches[i] != Unset {
+					start, end := skipped.pair(int(matches[i]), int(matches[i+1]))
+					matches[i], matches[i+1] = lib.Tsize_t(start), lib.Tsize_t(end)
+				}
+			}
 		}
 
+		// Add the match to the output
+		out = append(out, matches)
+
 		// If multiple matches disabled, break
 		if !multi {
 			break
 		}
 	}
+	runtime.KeepAlive(b)
 	return out, nil
 }
 
+// matchError converts an error code returned by pcre2 while matching
+// with the match data md into a Go error. If matching failed because
+// the budget would have been exceeded, it returns a *BudgetError, and
+// if the subject is invalid UTF-8, it returns a *UTFError.
+func (r *Regexp) matchError(tls *libc.TLS, md uintptr, code int32) error {
+	if code == lib.DPCRE2_ERROR_NOMEMORY {
+		if err := r.mem.deniedError(); err != nil {
+			return err
+		}
+	}
+	if isUTFError(code) {
+		return newUTFError(tls, code, lib.Xpcre2_get_startchar_8(tls, md))
+	}
+	return codeToError(tls, code)
+}
+
+// nextMatch applies the rules for successive matches to the match in
+// ovec, found by searching from offset. It reports whether the match
+// should be returned, and the offset and previous match end to use
+// for the next search.
+func nextMatch(b []byte, ovec []lib.Tsize_t, offset, prevEnd lib.Tsize_t, utf bool) (accept bool, next, end lib.Tsize_t) {
+	// An empty match directly after the previous match is ignored
+	accept = !(ovec[1] == offset && ovec[0] == prevEnd)
+
+	if ovec[1] == offset {
+		// The match is empty, so move to the next character
+		// to avoid finding the same match again.
+		next = nextChar(b, offset, utf)
+	} else {
+		// Set the next offset to the end index of the match
+		next = ovec[1]
+	}
+	return accept, next, ovec[1]
+}
+
+// nextChar returns the offset of the character after the one at offset.
+// If utf is false, characters are bytes.
+func nextChar(b []byte, offset lib.Tsize_t, utf bool) lib.Tsize_t {
+	width := 1
+	if utf && int(offset) < len(b) {
+		_, width = utf8.DecodeRune(b[offset:])
+	}
+	return offset + lib.Tsize_t(width)
+}
+
+// dfaWorkspaceSize is the initial number of ints in the workspace used
+// by pcre2_dfa_match. It is doubled, up to maxDFAWorkspaceSize, when
+// pcre2 reports that the workspace is too small.
+const (
+	dfaWorkspaceSize    = 1000
+	maxDFAWorkspaceSize = 1 << 20
+)
+
+// exec runs a single match at the given offset using the match
+// state st, storing the result in md. If Longest was called, it finds the leftmost-longest
+// match using pcre2's DFA algorithm.
+func (r *Regexp) exec(st *matchState, subject uintptr, length, offset lib.Tsize_t, options uint32, md uintptr) int32 {
+	if !r.longest {
+		return lib.Xpcre2_match_8(st.tls, r.re, subject, length, offset, options, md, st.mctx)
+	}
+
+	ret := r.dfaExec(st, subject, length, offset, options, md)
+	switch ret {
+	case lib.DPCRE2_ERROR_DFA_UITEM, lib.DPCRE2_ERROR_DFA_UCOND, lib.DPCRE2_ERROR_DFA_RECURSE, lib.DPCRE2_ERROR_DFA_UINVALID_UTF:
+		// The DFA algorithm doesn't support features such as
+		// backreferences or the MatchInvalidUTF option, so
+		// fall back to leftmost-first matching.
+		return lib.Xpcre2_match_8(st.tls, r.re, subject, length, offset, options, md, st.mctx)
+	}
+	if ret < 0 {
+		return ret
+	}
+
+	// The DFA algorithm doesn't record submatches, so the pattern is
+	// matched again, requiring the match to span the longest match.
+	ovec := unsafe.Slice((*lib.Tsize_t)(unsafe.Pointer(lib.Xpcre2_get_ovector_pointer_8(st.tls, md))), lib.Xpcre2_get_ovector_count_8(st.tls, md)*2)
+	start, end := ovec[0], ovec[1]
+
+	ret = lib.Xpcre2_match_8(st.tls, r.re, subject, end, start, options|lib.DPCRE2_ANCHORED|lib.DPCRE2_ENDANCHORED, md, st.mctx)
+	if ret >= 0 && ovec[0] == start && ovec[1] == end {
+		return ret
+	}
+
+	// If the match depends on text after its end, such as with a
+	// lookahead, the submatches can't be recovered.
+	for i := range ovec {
+		ovec[i] = Unset
+	}
+	ovec[0], ovec[1] = start, end
+	return 1
+}
+
+// dfaExec runs a single match at the given offset using pcre2's DFA
+// algorithm, which stores every match found at the leftmost
+// start position in md, longest first.
+func (r *Regexp) dfaExec(st *matchState, subject uintptr, length, offset lib.Tsize_t, options uint32, md uintptr) int32 {
+	if st.workspace == nil {
+		st.workspace = make([]int32, dfaWorkspaceSize)
+	}
+	for {
+		ret := lib.Xpcre2_dfa_match_8(st.tls, r.re, subject, length, offset, options, md, st.mctx, uintptr(unsafe.Pointer(&st.workspace[0])), lib.Tsize_t(len(st.workspace)))
+		if ret != lib.DPCRE2_ERROR_DFA_WSSIZE || len(st.workspace) >= maxDFAWorkspaceSize {
+			return ret
+		}
+		// The larger workspace is kept for later matches
+		st.workspace = make([]int32, len(st.workspace)*2)
+	}
+}
+
 // patternInfo calls the underlying pcre pattern info function
 // and returns information about the compiled regular expression
 func (r *Regexp) patternInfo(what uint32) (out uint32) {
@@ -734,21 +1173,92 @@ func (r *Regexp) patternInfo(what uint32) (out uint32) {
 	return
 }
 
-// Close frees resources used by the regular expression.
+// lifecycle tracks whether an expression has been closed. It's
+// shared by copies of the expression, such as with UnmarshalText.
+// Matches hold a read lock, so that Close waits for them to finish.
+type lifecycle struct {
+	sync.RWMutex
+	closed bool
+}
+
+// acquire prevents the expression from being closed until release
+// is called. It returns ErrClosed if the expression is already closed.
+//
+// Methods that call acquire must not call other methods that call it,
+// as Close would wait for them while preventing them from continuing.
+func (r *Regexp) acquire() error {
+	if r.life == nil {
+		return ErrClosed
+	}
+
+	r.life.RLock()
+	if r.life.closed {
+		r.life.RUnlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// release allows the expression to be closed once
+// other matches using it have finished.
+func (r *Regexp) release() {
+	r.life.RUnlock()
+}
+
+// closed reports whether the expression has been closed
+func (r *Regexp) closed() bool {
+	if err := r.acquire(); err != nil {
+		return true
+	}
+	r.release()
+	return false
+}
+
+// Close frees resources used by the regular expression. It waits for
+// matches that are running to finish. Calling Close more than once,
+// including concurrently, has no effect. Once the expression is closed,
+// its methods return or panic with ErrClosed.
 func (r *Regexp) Close() error {
-	if r == nil {
+	// If the resources belong to another expression, as
+	// with UnmarshalText, close that expression instead.
+	if r != nil && r.owner != nil {
+		return r.owner.Close()
+	}
+
+	if r == nil || r.life == nil {
+		return nil
+	}
+
+	r.life.Lock()
+	defer r.life.Unlock()
+
+	// If the expression has already been closed, do nothing
+	if r.life.closed {
 		return nil
 	}
+	r.life.closed = true
+
+	// The finalizer is no longer needed once the expression is closed
+	runtime.SetFinalizer(r, nil)
 
 	// Close thread-local storage
 	defer r.tls.Close()
 
+	// Free the match states, including the ones used by MatchData
+	r.closeStates()
 	// Free the compiled code
 	lib.Xpcre2_code_free_8(r.tls, r.re)
 	// Free the match context
 	lib.Xpcre2_match_context_free_8(r.tls, r.mctx)
-	// Set regular expression to null
+	// Remove the account, which no longer has any memory in use
+	closeAccount(r.memID)
+	// Allow another expression to use the budget
+	if r.mem.budget != nil {
+		r.mem.budget.release(LiveRegexps, 1)
+	}
+	// Set regular expression and match context to null
 	r.re = 0
+	r.mctx = 0
 
 	return nil
 }
@@ -45,6 +45,12 @@ func TestMatch(t *testing.T) {
 	if !matches {
 		t.Error("expected 8 USD to match")
 	}
+	// An empty match of an empty subject is a match
+	empty := pcre.MustCompile(`a*`)
+	defer empty.Close()
+	if !empty.Match(nil) || !empty.MatchString("") {
+		t.Error("expected a* to match an empty subject")
+	}
 }
 
 func TestMatchUngreedy(t *testing.T) {
@@ -187,7 +193,7 @@ func TestSubexpIndex(t *testing.T) {
 }
 
 func TestConcurrency(t *testing.T) {
-	r := pcre.MustCompile(`\d*`)
+	r := pcre.MustCompile(`\d+`)
 	defer r.Close()
 
 	wg := &sync.WaitGroup{}
@@ -298,3 +304,84 @@ func TestVarnish(t *testing.T) {
 		t.Errorf(`Expected ["varnish" ""], got %q`, matches)
 	}
 }
+
+func TestClone(t *testing.T) {
+	r := pcre.MustCompile(`(?<word>\w+)(?C1)`)
+	defer r.Close()
+
+	calls := 0
+	err := r.SetCallout(func(cb *pcre.CalloutBlock) int32 {
+		calls++
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := r.Clone()
+	defer c.Close()
+
+	if c.String() != r.String() {
+		t.Errorf("expected %q, got %q", r.String(), c.String())
+	}
+	if !reflect.DeepEqual(c.SubexpNames(), r.SubexpNames()) {
+		t.Errorf("expected %q, got %q", r.SubexpNames(), c.SubexpNames())
+	}
+
+	// The callout is copied from the original
+	if got := c.FindString("hello"); got != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 callout, got %d", calls)
+	}
+
+	// Changing the clone's callout doesn't affect the original
+	cloneCalls := 0
+	err = c.SetCallout(func(cb *pcre.CalloutBlock) int32 {
+		cloneCalls++
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MatchString("a")
+	r.MatchString("a")
+	if calls != 2 || cloneCalls != 1 {
+		t.Errorf("expected 2 and 1 callouts, got %d and %d", calls, cloneCalls)
+	}
+
+	// Neither do limits
+	if err := c.SetMatchLimit(1); err != nil {
+		t.Fatal(err)
+	}
+	if !r.MatchString("abc") {
+		t.Error("expected original to match")
+	}
+
+	// The clone remains usable after the original is closed
+	r.Close()
+	c.SetMatchLimit(1000)
+	if !c.MatchString("abc") {
+		t.Error("expected clone to match")
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	const expr = `(?<year>\d{4})-(?<month>\d{2})-(?<day>\d{2})T(?<hour>\d{2}):(?<minute>\d{2})`
+
+	r := pcre.MustCompile(expr)
+	defer r.Close()
+
+	b.Run("Clone", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.Clone().Close()
+		}
+	})
+
+	b.Run("Compile", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pcre.MustCompile(expr).Close()
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package pcre
+
+import (
+	"strconv"
+	"strings"
+
+	"go.elara.ws/pcre/syntax"
+)
+
+// CompilePOSIX is like Compile but restricts the regular expression
+// to POSIX ERE (egrep) syntax and changes the match semantics to
+// leftmost-longest, as with Go's regexp.CompilePOSIX.
+//
+// That is, when matching against text, the regexp returns a match that
+// begins as early as possible in the input (leftmost), and among those
+// it chooses a match that is as long as possible. Like Go's regexp package,
+// ^ and $ match at the start and end of lines.
+//
+// Submatches are chosen by matching again within the longest match
+// using Perl semantics, which may differ from the POSIX rules for
+// submatches.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func CompilePOSIX(expr string) (*Regexp, error) {
+	tree, err := syntax.Parse(expr, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPOSIX(expr, tree); err != nil {
+		return nil, err
+	}
+
+	r, err := CompileOpts(expr, Multiline|AltCircumflex)
+	if err != nil {
+		return nil, err
+	}
+	r.longest = true
+	return r, nil
+}
+
+// MustCompilePOSIX compiles the given pattern using CompilePOSIX
+// and panics if there was an error.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func MustCompilePOSIX(expr string) *Regexp {
+	rgx, err := CompilePOSIX(expr)
+	if err != nil {
+		panic(err)
+	}
+	return rgx
+}
+
+// checkPOSIX returns an error if the syntax tree
+// uses features that are not part of POSIX ERE.
+func checkPOSIX(expr string, tree *syntax.Node) error {
+	var posixErr *syntax.Error
+	syntax.Walk(tree, func(n *syntax.Node) bool {
+		if posixErr != nil {
+			return false
+		}
+
+		feature := ""
+		switch n.Op {
+		case syntax.OpEmpty, syntax.OpLiteral, syntax.OpAnyChar, syntax.OpConcat, syntax.OpAlternate:
+		case syntax.OpCharClass:
+			if i := perlClassEscape(n.Text); i != -1 {
+				feature = strconv.Quote(n.Text[i : i+2])
+			}
+		case syntax.OpAssertion:
+			if n.Text != "^" && n.Text != "$" {
+				feature = strconv.Quote(n.Text)
+			}
+		case syntax.OpRepeat:
+			if n.Mode == syntax.Possessive {
+				feature = "possessive quantifier"
+			}
+		case syntax.OpGroup:
+			if n.Group != syntax.GroupCapture || n.Name != "" {
+				feature = strconv.Quote(expr[n.Pos:n.Sub[0].Pos])
+			}
+		case syntax.OpConditional:
+			feature = "conditional group"
+		default:
+			feature = strconv.Quote(expr[n.Pos:n.End])
+		}
+
+		if feature != "" {
+			posixErr = &syntax.Error{Offset: n.Pos, Msg: feature + " is not POSIX ERE syntax"}
+		}
+		return true
+	})
+	if posixErr != nil {
+		return posixErr
+	}
+	return nil
+}
+
+// perlClassEscape returns the index of the first escape sequence
+// in a character class that is not allowed in POSIX ERE, or -1.
+func perlClassEscape(class string) int {
+	for i := 0; i < len(class)-1; i++ {
+		if class[i] != '\\' {
+			continue
+		}
+		if strings.IndexByte("dDwWsShHvVpPNRX", class[i+1]) != -1 {
+			return i
+		}
+		i++
+	}
+	return -1
+}
@@ -0,0 +1,66 @@
+package pcre_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestCompilePOSIX(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+	}{
+		{`if|ifdef|[a-z]+`, "ifdef x if ifx"},
+		{`a|ab|abc`, "abcab"},
+		{`(a|ab)(c|bcd)`, "abcd"},
+		{`^[0-9]+|[0-9.]+$`, "12.5\n3.25"},
+		{`x*`, "axxbx"},
+		{`[[:alpha:]]+`, "ab1cd"},
+	}
+
+	for _, test := range tests {
+		r := pcre.MustCompilePOSIX(test.pattern)
+		std := regexp.MustCompilePOSIX(test.pattern)
+
+		if got, expected := r.FindAllStringIndex(test.subject, -1), std.FindAllStringIndex(test.subject, -1); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: FindAllStringIndex: expected %v, got %v", test.pattern, expected, got)
+		}
+		if got, expected := r.ReplaceAllString(test.subject, "<$0>"), std.ReplaceAllString(test.subject, "<$0>"); got != expected {
+			t.Errorf("%s: ReplaceAllString: expected %q, got %q", test.pattern, expected, got)
+		}
+		if got, expected := r.Split(test.subject, -1), std.Split(test.subject, -1); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: Split: expected %q, got %q", test.pattern, expected, got)
+		}
+
+		r.Close()
+	}
+
+	for _, pattern := range []string{`\d`, `a(?=b)`, `(?:a)`, `(?<n>a)`, `\bx`, `[\w]`, `a++`, `(a)\1`, `(?i)a`} {
+		_, err := pcre.CompilePOSIX(pattern)
+		if err == nil {
+			t.Errorf("%s: expected error", pattern)
+		}
+	}
+}
+
+func TestLongestReplace(t *testing.T) {
+	r := pcre.MustCompile(`<|<=|<<=?`)
+	defer r.Close()
+
+	if out := r.ReplaceAllString("a<=b<<=c", "[$0]"); out != "a[<]=b[<][<]=c" {
+		t.Errorf("unexpected leftmost-first output: %s", out)
+	}
+
+	r.Longest()
+	if out := r.ReplaceAllString("a<=b<<=c", "[$0]"); out != "a[<=]b[<<=]c" {
+		t.Errorf("unexpected leftmost-longest output: %s", out)
+	}
+
+	expected := []string{"a", "b", "c"}
+	if split := r.Split("a<=b<<=c", -1); !reflect.DeepEqual(split, expected) {
+		t.Errorf("expected %q, got %q", expected, split)
+	}
+}
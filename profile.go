@@ -0,0 +1,207 @@
+package pcre
+
+import (
+	"errors"
+	"math"
+
+	"go.elara.ws/pcre/lib"
+	"modernc.org/libc"
+)
+
+// maxProfileLimit is the highest match and depth limit
+// used when measuring the cost of a match. It is the same
+// as pcre2's default match limit.
+const maxProfileLimit = 10000000
+
+// superLinearExponent is the growth exponent above which
+// the cost of matching is considered super-linear.
+const superLinearExponent = 1.5
+
+// MatchStats contains statistics about the cost of a match.
+type MatchStats struct {
+	// Matched reports whether the expression matched the subject.
+	Matched bool
+
+	// Steps contains the amount of items processed during the match,
+	// as reported by automatic callouts.
+	Steps int
+
+	// Backtracks contains the amount of steps that were
+	// preceded by a backtrack.
+	Backtracks int
+
+	// StartPositions contains the amount of positions in the
+	// subject at which a match attempt was started.
+	StartPositions int
+
+	// MatchCalls contains the amount of times pcre2's internal match
+	// function was called. This is the value counted against the match
+	// limit, so it is the lowest match limit with which the match succeeds.
+	MatchCalls uint32
+
+	// Depth contains the maximum backtracking depth reached during the
+	// match. This is the lowest depth limit with which the match succeeds.
+	Depth uint32
+}
+
+// Profile matches the regular expression against subject
+// and returns statistics about the cost of the match.
+//
+// Profiling runs the match many times, so it should only be
+// used for testing and diagnostics.
+func (r *Regexp) Profile(subject string) (*MatchStats, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	stats := &MatchStats{}
+
+	match, err := r.autoCallout(subject, func(cb *CalloutBlock) {
+		stats.Steps++
+		if cb.CalloutFlags&CalloutBacktrack != 0 {
+			stats.Backtracks++
+		}
+		if cb.CalloutFlags&CalloutStartMatch != 0 {
+			stats.StartPositions++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Matched = match != nil
+
+	stats.MatchCalls, err = r.minLimit(subject, lib.Xpcre2_set_match_limit_8, lib.DPCRE2_ERROR_MATCHLIMIT)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.Depth, err = r.minLimit(subject, lib.Xpcre2_set_depth_limit_8, lib.DPCRE2_ERROR_DEPTHLIMIT)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// minLimit finds the lowest limit with which matching subject does not
+// fail with the given error code, using set to apply each limit.
+func (r *Regexp) minLimit(subject string, set func(tls *libc.TLS, mctx uintptr, limit uint32) int32, code int32) (uint32, error) {
+	lr, err := CompileWith(r.expr, r.config)
+	if err != nil {
+		return 0, err
+	}
+	defer lr.Close()
+
+	// exceeds reports whether the match exceeds the given limit
+	exceeds := func(limit uint32) (bool, error) {
+		if err := lr.setLimit(set, limit); err != nil {
+			return false, err
+		}
+		_, err := lr.match([]byte(subject), 0, false)
+		var pe *PcreError
+		if errors.As(err, &pe) && pe.code == code {
+			return true, nil
+		}
+		return false, err
+	}
+
+	exceeded, err := exceeds(maxProfileLimit)
+	if err != nil {
+		return 0, err
+	} else if exceeded {
+		return 0, codeToError(lr.tls, code)
+	}
+
+	var low, high uint32 = 1, maxProfileLimit
+	for low < high {
+		mid := low + (high-low)/2
+		exceeded, err := exceeds(mid)
+		if err != nil {
+			return 0, err
+		}
+		if exceeded {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+
+	return low, nil
+}
+
+// Growth contains the cost of matching subjects of increasing size,
+// as returned by MeasureGrowth.
+type Growth struct {
+	// Sizes contains the sizes passed to MeasureGrowth.
+	Sizes []int
+
+	// Stats contains the statistics for the subject of each size.
+	Stats []*MatchStats
+
+	// Exponent contains the estimated exponent k such that the cost
+	// of matching a subject of size n grows like n^k. The cost is
+	// measured as the amount of internal match function calls.
+	Exponent float64
+}
+
+// SuperLinear reports whether the cost of matching grows
+// faster than linearly with the size of the subject.
+func (g *Growth) SuperLinear() bool {
+	return g.Exponent > superLinearExponent
+}
+
+// MeasureGrowth profiles the regular expression against subjects generated
+// by gen for each of the given sizes and estimates how the cost of matching
+// grows with the size. At least two distinct positive sizes are required.
+//
+// This can be used in tests to detect catastrophic backtracking:
+//
+//	g, err := r.MeasureGrowth(func(n int) string {
+//		return strings.Repeat("a", n) + "!"
+//	}, 8, 16, 32)
+//	if err != nil || g.SuperLinear() {
+//		t.Error("pattern is too expensive")
+//	}
+//
+// If a subject exceeds the default match limit, MeasureGrowth
+// returns an error, which indicates that the cost is too high.
+func (r *Regexp) MeasureGrowth(gen func(n int) string, sizes ...int) (*Growth, error) {
+	g := &Growth{Sizes: sizes}
+
+	var xs, ys []float64
+	for _, size := range sizes {
+		stats, err := r.Profile(gen(size))
+		if err != nil {
+			return nil, err
+		}
+		g.Stats = append(g.Stats, stats)
+
+		if size > 0 {
+			xs = append(xs, math.Log(float64(size)))
+			ys = append(ys, math.Log(float64(stats.MatchCalls)))
+		}
+	}
+
+	g.Exponent = slope(xs, ys)
+	return g, nil
+}
+
+// slope returns the slope of the least-squares
+// line fitted to the given points.
+func slope(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
@@ -0,0 +1,68 @@
+package pcre_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestProfile(t *testing.T) {
+	r := pcre.MustCompile(`(a+)+$`)
+	defer r.Close()
+
+	stats, err := r.Profile("aaaaaaaa!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Matched {
+		t.Error("expected no match")
+	}
+
+	if stats.StartPositions != 8 {
+		t.Errorf("expected 8 start positions, got %d", stats.StartPositions)
+	}
+
+	if stats.Backtracks == 0 || stats.Steps <= stats.Backtracks {
+		t.Errorf("unexpected step counts: %+v", stats)
+	}
+
+	if stats.MatchCalls < 100 {
+		t.Errorf("expected at least 100 match calls, got %d", stats.MatchCalls)
+	}
+}
+
+func TestMeasureGrowth(t *testing.T) {
+	gen := func(n int) string {
+		return strings.Repeat("a", n) + "!"
+	}
+
+	r := pcre.MustCompile(`(a|aa)+$`)
+	defer r.Close()
+
+	g, err := r.MeasureGrowth(gen, 4, 8, 12, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !g.SuperLinear() {
+		t.Errorf("expected super-linear growth, got exponent %f", g.Exponent)
+	}
+
+	r = pcre.MustCompile(`a+!`)
+	defer r.Close()
+
+	g, err = r.MeasureGrowth(gen, 4, 8, 12, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.SuperLinear() {
+		t.Errorf("expected linear growth, got exponent %f", g.Exponent)
+	}
+
+	if len(g.Stats) != 4 || !g.Stats[0].Matched {
+		t.Errorf("expected 4 matching results, got %+v", g.Stats)
+	}
+}
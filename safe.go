@@ -0,0 +1,158 @@
+package pcre
+
+import (
+	"fmt"
+	"strings"
+
+	"go.elara.ws/pcre/lib"
+	"go.elara.ws/pcre/syntax"
+)
+
+// Limits used for expressions compiled by CompileSafe
+const (
+	// SafeMatchLimit is the match limit set by CompileSafe
+	SafeMatchLimit = 100000
+	// SafeDepthLimit is the depth limit set by CompileSafe
+	SafeDepthLimit = 1000
+	// SafeHeapLimit is the heap limit, in kibibytes, set by CompileSafe
+	SafeHeapLimit = 1024
+	// SafeMaxLookbehind is the maximum lookbehind
+	// length, in characters, allowed by CompileSafe
+	SafeMaxLookbehind = 255
+)
+
+// backtrackingVerbs contains the backtracking control verbs
+// rejected by CompileSafe. An empty name is a shorthand for MARK.
+var backtrackingVerbs = map[string]bool{
+	"":       true,
+	"ACCEPT": true,
+	"COMMIT": true,
+	"F":      true,
+	"FAIL":   true,
+	"MARK":   true,
+	"PRUNE":  true,
+	"SKIP":   true,
+	"THEN":   true,
+}
+
+// UnsafeFeatureError is returned by CompileSafe when
+// a pattern uses a feature that is not allowed.
+type UnsafeFeatureError struct {
+	// Feature contains a description of the feature
+	Feature string
+	// Offset contains the offset of the feature within the pattern
+	Offset int
+}
+
+// Error returns the error message, prepending the offset
+func (e *UnsafeFeatureError) Error() string {
+	return fmt.Sprintf("offset %d: %s not allowed in safe mode", e.Offset, e.Feature)
+}
+
+// CompileSafe compiles the provided pattern using the given options,
+// rejecting features that only a backtracking matcher can support,
+// so that the matching cost of the expression stays predictable.
+//
+// Backreferences, recursion, conditionals, callouts, backtracking
+// control verbs, and lookbehinds longer than SafeMaxLookbehind are
+// rejected with an *UnsafeFeatureError. The returned expression has
+// its match, depth and heap limits set to SafeMatchLimit, SafeDepthLimit
+// and SafeHeapLimit, so matching fails with an error instead of running
+// for a long time.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func CompileSafe(pattern string, options CompileOption) (*Regexp, error) {
+	if options&AutoCallout != 0 {
+		return nil, &UnsafeFeatureError{Feature: "automatic callout", Offset: 0}
+	}
+
+	r, err := CompileOpts(pattern, options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.checkSafe()
+	if err == nil {
+		err = r.SetMatchLimit(SafeMatchLimit)
+	}
+	if err == nil {
+		err = r.SetDepthLimit(SafeDepthLimit)
+	}
+	if err == nil {
+		err = r.SetHeapLimit(SafeHeapLimit)
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// MustCompileSafe compiles the given pattern using CompileSafe
+// and panics if there was an error.
+//
+// Close() should be called on the returned expression
+// once it is no longer needed.
+func MustCompileSafe(pattern string, options CompileOption) *Regexp {
+	rgx, err := CompileSafe(pattern, options)
+	if err != nil {
+		panic(err)
+	}
+	return rgx
+}
+
+// checkSafe returns an error if the expression
+// uses features that aren't allowed in safe mode.
+func (r *Regexp) checkSafe() error {
+	tree, err := syntax.Parse(r.expr, syntax.Flags(r.opts))
+	if err != nil {
+		return err
+	}
+
+	lookbehind := -1
+	var unsafeErr *UnsafeFeatureError
+	syntax.Walk(tree, func(n *syntax.Node) bool {
+		if unsafeErr != nil {
+			return false
+		}
+
+		feature := ""
+		switch n.Op {
+		case syntax.OpBackref:
+			feature = "backreference"
+		case syntax.OpRecursion:
+			feature = "recursion"
+		case syntax.OpConditional:
+			feature = "conditional group"
+		case syntax.OpCallout:
+			feature = "callout"
+		case syntax.OpVerb:
+			if backtrackingVerbs[strings.ToUpper(n.Name)] {
+				feature = "backtracking control verb"
+			}
+		case syntax.OpGroup:
+			switch n.Group {
+			case syntax.GroupLookbehind, syntax.GroupNegativeLookbehind, syntax.GroupNonAtomicLookbehind:
+				if lookbehind == -1 {
+					lookbehind = n.Pos
+				}
+			}
+		}
+
+		if feature != "" {
+			unsafeErr = &UnsafeFeatureError{Feature: feature, Offset: n.Pos}
+		}
+		return true
+	})
+	if unsafeErr != nil {
+		return unsafeErr
+	}
+
+	if lookbehind != -1 && r.patternInfo(lib.DPCRE2_INFO_MAXLOOKBEHIND) > SafeMaxLookbehind {
+		return &UnsafeFeatureError{Feature: "long lookbehind", Offset: lookbehind}
+	}
+
+	return nil
+}
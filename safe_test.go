@@ -0,0 +1,84 @@
+package pcre_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestCompileSafe(t *testing.T) {
+	r := pcre.MustCompileSafe(`(?<=\d)[a-z]+(?=!)|(?>x+)`, 0)
+	defer r.Close()
+
+	if r.FindString("1abc!") != "abc" {
+		t.Errorf("expected abc, got %q", r.FindString("1abc!"))
+	}
+
+	tests := []struct {
+		pattern string
+		feature string
+		offset  int
+	}{
+		{`(a)\1`, "backreference", 3},
+		{`(?<n>a)\k<n>`, "backreference", 7},
+		{`a(?R)?`, "recursion", 1},
+		{`(a)(?1)`, "recursion", 3},
+		{`(a)?(?(1)b|c)`, "conditional group", 4},
+		{`a(?C1)`, "callout", 1},
+		{`a(*SKIP)b`, "backtracking control verb", 1},
+		{`a(*:mark)`, "backtracking control verb", 1},
+		{`x(?<=` + strings.Repeat("a", 300) + `)`, "long lookbehind", 1},
+		{`(a)(b)(c)(d)(e)(f)(g)(h)(i)(j)(k)\11`, "backreference", 33},
+	}
+
+	for _, test := range tests {
+		_, err := pcre.CompileSafe(test.pattern, 0)
+
+		var ufe *pcre.UnsafeFeatureError
+		if !errors.As(err, &ufe) {
+			t.Errorf("%s: expected UnsafeFeatureError, got %v", test.pattern, err)
+			continue
+		}
+
+		if ufe.Feature != test.feature || ufe.Offset != test.offset {
+			t.Errorf("%s: expected %s at %d, got %s", test.pattern, test.feature, test.offset, ufe)
+		}
+	}
+
+	// Start-of-pattern settings are not backtracking verbs
+	r = pcre.MustCompileSafe(`(*UTF)a`, 0)
+	r.Close()
+
+	// Numbers that can't refer to a group are octal escapes
+	r = pcre.MustCompileSafe(`a\11b`, 0)
+	if !r.MatchString("a\tb") {
+		t.Errorf("expected %s to match a tab", r)
+	}
+	r.Close()
+
+	r = pcre.MustCompileSafe(`^[\c[:alpha:]+ +$`, pcre.Extended)
+	if !r.MatchString("\x1b:") {
+		t.Errorf("expected %s to match", r)
+	}
+	r.Close()
+
+	_, err := pcre.CompileSafe(`(`, 0)
+	if err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestCompileSafeLimits(t *testing.T) {
+	r := pcre.MustCompileSafe(`(a+)+$`, 0)
+	defer r.Close()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected match limit to be exceeded")
+		}
+	}()
+
+	r.MatchString(strings.Repeat("a", 40) + "!")
+}
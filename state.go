@@ -0,0 +1,182 @@
+package pcre
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+
+	"modernc.org/libc"
+)
+
+// matchState holds the resources needed for a single match at a time.
+// The compiled code is only read while matching, so it's shared between
+// goroutines, while each concurrent match uses its own matchState.
+type matchState struct {
+	tls  *libc.TLS
+	md   uintptr
+	ovec []lib.Tsize_t
+
+	// mctx is a copy of the expression's match context, so that
+	// callouts and limits can be changed while matches are running.
+	// It's copied again when version doesn't match the expression's.
+	mctx    uintptr
+	version uint64
+
+	// workspace is used by pcre2_dfa_match. It's allocated
+	// the first time the state is used with Longest.
+	workspace []int32
+}
+
+// statePool holds the match states of a regular expression. Unlike
+// a sync.Pool, it keeps track of every state it created, including
+// the ones in use, so that they're all freed when the expression is
+// closed rather than whenever finalizers run.
+type statePool struct {
+	mtx  sync.Mutex
+	free []*matchState
+	open map[*matchState]struct{}
+}
+
+func newStatePool() *statePool {
+	return &statePool{open: map[*matchState]struct{}{}}
+}
+
+// newMatchState creates a match state for the regular expression
+func (r *Regexp) newMatchState() (*matchState, error) {
+	tls := libc.NewTLS()
+
+	md := lib.Xpcre2_match_data_create_from_pattern_8(tls, r.re, 0)
+	if md == 0 {
+		err := r.matchError(tls, 0, lib.DPCRE2_ERROR_NOMEMORY)
+		tls.Close()
+		return nil, err
+	}
+
+	ovec := lib.Xpcre2_get_ovector_pointer_8(tls, md)
+	st := &matchState{
+		tls:  tls,
+		md:   md,
+		ovec: unsafe.Slice((*lib.Tsize_t)(unsafe.Pointer(ovec)), lib.Xpcre2_get_ovector_count_8(tls, md)*2),
+	}
+
+	// Register the state before syncing it, so
+	// that it's freed if copying the context fails.
+	r.states.mtx.Lock()
+	r.states.open[st] = struct{}{}
+	r.states.mtx.Unlock()
+
+	if err := r.syncState(st); err != nil {
+		// The state can be synced again when it's reused
+		r.putState(st)
+		return nil, err
+	}
+	return st, nil
+}
+
+// getState returns a match state from the pool, or a new one
+// if the pool is empty. putState should be called once the
+// match is done.
+func (r *Regexp) getState() (*matchState, error) {
+	r.states.mtx.Lock()
+	n := len(r.states.free)
+	if n == 0 {
+		r.states.mtx.Unlock()
+		return r.newMatchState()
+	}
+	st := r.states.free[n-1]
+	r.states.free[n-1] = nil
+	r.states.free = r.states.free[:n-1]
+	r.states.mtx.Unlock()
+
+	if err := r.syncState(st); err != nil {
+		r.putState(st)
+		return nil, err
+	}
+	return st, nil
+}
+
+// putState returns a match state to the pool
+func (r *Regexp) putState(st *matchState) {
+	r.states.mtx.Lock()
+	defer r.states.mtx.Unlock()
+
+	// The state may have been freed by closeState
+	if _, ok := r.states.open[st]; ok {
+		r.states.free = append(r.states.free, st)
+	}
+}
+
+// closeState frees a match state that's not in the pool, such
+// as one used by MatchData, unless it has already been freed.
+func (r *Regexp) closeState(st *matchState) {
+	r.states.mtx.Lock()
+	_, ok := r.states.open[st]
+	delete(r.states.open, st)
+	r.states.mtx.Unlock()
+
+	if ok {
+		st.close()
+	}
+}
+
+// syncState copies the expression's match context into
+// the match state if it was changed since the last copy.
+func (r *Regexp) syncState(st *matchState) error {
+	if st.mctx != 0 && st.version == atomic.LoadUint64(r.version) {
+		return nil
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if st.mctx != 0 {
+		lib.Xpcre2_match_context_free_8(st.tls, st.mctx)
+	}
+	st.mctx = lib.Xpcre2_match_context_copy_8(st.tls, r.mctx)
+	if st.mctx == 0 {
+		return r.matchError(st.tls, st.md, lib.DPCRE2_ERROR_NOMEMORY)
+	}
+	st.version = atomic.LoadUint64(r.version)
+	return nil
+}
+
+// configChanged makes match states copy the match context again
+// before their next match. It must be called with r.mtx held,
+// after the match context is modified.
+func (r *Regexp) configChanged() {
+	atomic.AddUint64(r.version, 1)
+}
+
+// closeStates frees all match states created for the expression,
+// including the ones used by MatchData values that weren't closed.
+func (r *Regexp) closeStates() {
+	r.states.mtx.Lock()
+	open := r.states.open
+	r.states.open = map[*matchState]struct{}{}
+	r.states.free = nil
+	r.states.mtx.Unlock()
+
+	for st := range open {
+		st.close()
+	}
+}
+
+// close frees resources used by the match state
+func (st *matchState) close() {
+	// If the match state has already been closed, do nothing
+	if st.md == 0 {
+		return
+	}
+
+	// Close thread-local storage
+	defer st.tls.Close()
+
+	lib.Xpcre2_match_data_free_8(st.tls, st.md)
+	lib.Xpcre2_match_context_free_8(st.tls, st.mctx)
+	st.md = 0
+	st.mctx = 0
+	st.ovec = nil
+	st.workspace = nil
+}
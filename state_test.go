@@ -0,0 +1,113 @@
+package pcre_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestConcurrentMatching(t *testing.T) {
+	r := pcre.MustCompile(`(\w+)=(\d+)`)
+	defer r.Close()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			subject := fmt.Sprintf("key%d=%d", i, i*i)
+			for j := 0; j < 100; j++ {
+				match := r.FindStringSubmatch(subject)
+				if len(match) != 3 || match[0] != subject || match[2] != fmt.Sprint(i*i) {
+					t.Errorf("unexpected match %q for %q", match, subject)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentLimits(t *testing.T) {
+	r := pcre.MustCompile(`(a+)+$`)
+	defer r.Close()
+
+	subject := strings.Repeat("a", 20) + "b"
+
+	// Make sure there are match states in the pool
+	// from before the limit was changed.
+	if !r.MatchString("aaa") {
+		t.Fatal("expected aaa to match")
+	}
+
+	if err := r.SetMatchLimit(100); err != nil {
+		t.Fatal(err)
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				err, _ := recover().(error)
+				var pe *pcre.PcreError
+				if !errors.As(err, &pe) {
+					t.Errorf("expected match limit error, got %v", err)
+				}
+			}()
+			r.MatchString(subject)
+		}()
+	}
+	wg.Wait()
+
+	// Callouts set after matching apply to later matches
+	c := pcre.MustCompile(`a(?C1)`)
+	defer c.Close()
+	c.MatchString("a")
+
+	called := false
+	err := c.SetCallout(func(cb *pcre.CalloutBlock) int32 {
+		called = true
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MatchString("a")
+	if !called {
+		t.Error("expected callout to be called")
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	r := pcre.MustCompile(`(\d+)-(\d+)`)
+	defer r.Close()
+
+	subject := "order 1234-5678 shipped"
+
+	b.Run("FindStringSubmatchIndex", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				r.FindStringSubmatchIndex(subject)
+			}
+		})
+	})
+
+	b.Run("MatchData", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			m := r.NewMatchData()
+			defer m.Close()
+
+			dst := make([]int, 0, 6)
+			for pb.Next() {
+				m.FindStringSubmatchIndexInto(dst, subject)
+			}
+		})
+	})
+}
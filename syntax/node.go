@@ -0,0 +1,427 @@
+// Package syntax parses pcre2 regular expressions into syntax trees
+// and prints them back, similar to Go's regexp/syntax package.
+//
+// The syntax trees are meant for inspecting and rewriting patterns,
+// such as for linters and explainers. They do not replace compilation,
+// so patterns accepted by Parse may still be rejected by pcre2.
+package syntax
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.elara.ws/pcre/lib"
+)
+
+// Flags control the behavior of the parser. Their values are the
+// same as the corresponding compile options in the pcre package,
+// so a pcre.CompileOption can be converted directly to Flags.
+type Flags uint32
+
+const (
+	AltBsux       = Flags(lib.DPCRE2_ALT_BSUX)
+	AltVerbnames  = Flags(lib.DPCRE2_ALT_VERBNAMES)
+	Caseless      = Flags(lib.DPCRE2_CASELESS)
+	DotAll        = Flags(lib.DPCRE2_DOTALL)
+	DupNames      = Flags(lib.DPCRE2_DUPNAMES)
+	Extended      = Flags(lib.DPCRE2_EXTENDED)
+	ExtendedMore  = Flags(lib.DPCRE2_EXTENDED_MORE)
+	Literal       = Flags(lib.DPCRE2_LITERAL)
+	Multiline     = Flags(lib.DPCRE2_MULTILINE)
+	NoAutoCapture = Flags(lib.DPCRE2_NO_AUTO_CAPTURE)
+	Ungreedy      = Flags(lib.DPCRE2_UNGREEDY)
+	UTF           = Flags(lib.DPCRE2_UTF)
+	UCP           = Flags(lib.DPCRE2_UCP)
+)
+
+// Op represents the kind of a syntax tree node
+type Op uint8
+
+const (
+	// OpEmpty matches the empty string
+	OpEmpty Op = iota + 1
+	// OpLiteral matches Rune
+	OpLiteral
+	// OpAnyChar matches any character, represented by a dot
+	OpAnyChar
+	// OpCharClass matches a character class. Text contains the
+	// class, including the brackets.
+	OpCharClass
+	// OpCharType matches a generic character type such as \d or \R.
+	// Text contains the escape sequence.
+	OpCharType
+	// OpProperty matches a character with the Unicode property Name.
+	// Negated is set for \P and \p{^...}.
+	OpProperty
+	// OpAssertion is a simple assertion such as ^, $ or \b.
+	// Text contains the assertion.
+	OpAssertion
+	// OpResetMatchStart resets the start of the match, represented by \K
+	OpResetMatchStart
+	// OpConcat matches the concatenation of Sub
+	OpConcat
+	// OpAlternate matches any of the alternatives in Sub
+	OpAlternate
+	// OpRepeat matches Sub[0] between Min and Max times.
+	// Max is -1 if there is no upper bound.
+	OpRepeat
+	// OpGroup is a group of the kind Group, matching Sub[0]
+	OpGroup
+	// OpBackref is a backreference to the group with the number
+	// Index or the name Name.
+	OpBackref
+	// OpRecursion is a recursion or subroutine call to the group with
+	// the number Index or the name Name. Index 0 recurses the whole pattern.
+	OpRecursion
+	// OpConditional matches Sub[0] if Cond is true, or Sub[1], if
+	// present, otherwise.
+	OpConditional
+	// OpCondition is a condition of a conditional group that is not
+	// an assertion. Text contains the condition, such as "1", "<name>",
+	// "R" or "DEFINE". Index or Name are set for references to groups.
+	OpCondition
+	// OpVerb is a backtracking control verb or a start-of-pattern
+	// setting, such as (*SKIP), (*MARK:name) or (*UTF). Name contains
+	// the verb and Arg contains its argument, if any.
+	OpVerb
+	// OpCallout is a callout with the number Index or,
+	// if Name is set, the string Name.
+	OpCallout
+	// OpOptions changes the options for the rest of the enclosing
+	// group. Text contains the option letters, such as "i-x".
+	OpOptions
+)
+
+var opNames = [...]string{
+	OpEmpty:           "Empty",
+	OpLiteral:         "Literal",
+	OpAnyChar:         "AnyChar",
+	OpCharClass:       "CharClass",
+	OpCharType:        "CharType",
+	OpProperty:        "Property",
+	OpAssertion:       "Assertion",
+	OpResetMatchStart: "ResetMatchStart",
+	OpConcat:          "Concat",
+	OpAlternate:       "Alternate",
+	OpRepeat:          "Repeat",
+	OpGroup:           "Group",
+	OpBackref:         "Backref",
+	OpRecursion:       "Recursion",
+	OpConditional:     "Conditional",
+	OpCondition:       "Condition",
+	OpVerb:            "Verb",
+	OpCallout:         "Callout",
+	OpOptions:         "Options",
+}
+
+// String returns the name of the operation
+func (op Op) String() string {
+	if int(op) < len(opNames) && opNames[op] != "" {
+		return opNames[op]
+	}
+	return "Op(" + strconv.Itoa(int(op)) + ")"
+}
+
+// GroupKind represents the kind of a group
+type GroupKind uint8
+
+const (
+	GroupCapture GroupKind = iota
+	GroupNonCapture
+	GroupAtomic
+	GroupBranchReset
+	GroupLookahead
+	GroupNegativeLookahead
+	GroupLookbehind
+	GroupNegativeLookbehind
+	GroupNonAtomicLookahead
+	GroupNonAtomicLookbehind
+	GroupScriptRun
+	GroupAtomicScriptRun
+)
+
+var groupNames = [...]string{
+	GroupCapture:             "Capture",
+	GroupNonCapture:          "NonCapture",
+	GroupAtomic:              "Atomic",
+	GroupBranchReset:         "BranchReset",
+	GroupLookahead:           "Lookahead",
+	GroupNegativeLookahead:   "NegativeLookahead",
+	GroupLookbehind:          "Lookbehind",
+	GroupNegativeLookbehind:  "NegativeLookbehind",
+	GroupNonAtomicLookahead:  "NonAtomicLookahead",
+	GroupNonAtomicLookbehind: "NonAtomicLookbehind",
+	GroupScriptRun:           "ScriptRun",
+	GroupAtomicScriptRun:     "AtomicScriptRun",
+}
+
+// String returns the name of the group kind
+func (gk GroupKind) String() string {
+	if int(gk) < len(groupNames) {
+		return groupNames[gk]
+	}
+	return "GroupKind(" + strconv.Itoa(int(gk)) + ")"
+}
+
+// IsLookaround reports whether the group is a lookahead or lookbehind
+func (gk GroupKind) IsLookaround() bool {
+	return gk >= GroupLookahead && gk <= GroupNonAtomicLookbehind
+}
+
+// RepeatMode represents how a repetition backtracks
+type RepeatMode uint8
+
+const (
+	Greedy RepeatMode = iota
+	Lazy
+	Possessive
+)
+
+// Node is a node in a syntax tree
+type Node struct {
+	Op Op
+	// Flags contains the flags in effect at this node
+	Flags Flags
+
+	// Pos and End contain the offsets of the
+	// node's source text within the pattern.
+	Pos, End int
+
+	Sub  []*Node
+	Cond *Node
+
+	Rune     rune
+	Min, Max int
+	Mode     RepeatMode
+	Group    GroupKind
+	Index    int
+	Name     string
+	Arg      string
+	Negated  bool
+	Text     string
+}
+
+// Walk traverses the syntax tree rooted at n in depth-first order,
+// calling fn for each node. If fn returns false, the children
+// of that node are skipped.
+func Walk(n *Node, fn func(n *Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	Walk(n.Cond, fn)
+	for _, sub := range n.Sub {
+		Walk(sub, fn)
+	}
+}
+
+// String returns the pattern represented by the syntax tree.
+// Parsing the result with the same flags produces an equivalent tree.
+func (n *Node) String() string {
+	sb := &strings.Builder{}
+	n.write(sb)
+	return sb.String()
+}
+
+func (n *Node) write(sb *strings.Builder) {
+	switch n.Op {
+	case OpEmpty:
+	case OpLiteral:
+		writeLiteral(sb, n.Rune, n.Flags)
+	case OpAnyChar:
+		sb.WriteByte('.')
+	case OpCharClass, OpCharType, OpAssertion:
+		sb.WriteString(n.Text)
+	case OpProperty:
+		if n.Negated {
+			sb.WriteString(`\P{`)
+		} else {
+			sb.WriteString(`\p{`)
+		}
+		sb.WriteString(n.Name)
+		sb.WriteByte('}')
+	case OpResetMatchStart:
+		sb.WriteString(`\K`)
+	case OpConcat:
+		for _, sub := range n.Sub {
+			if sub.Op == OpAlternate {
+				writeNonCapture(sb, sub)
+			} else {
+				sub.write(sb)
+			}
+		}
+	case OpAlternate:
+		for i, sub := range n.Sub {
+			if i > 0 {
+				sb.WriteByte('|')
+			}
+			sub.write(sb)
+		}
+	case OpRepeat:
+		n.writeRepeat(sb)
+	case OpGroup:
+		n.writeGroup(sb)
+	case OpBackref:
+		if n.Name != "" {
+			sb.WriteString(`\k<` + n.Name + `>`)
+		} else {
+			sb.WriteString(`\g{` + strconv.Itoa(n.Index) + `}`)
+		}
+	case OpRecursion:
+		switch {
+		case n.Name != "":
+			sb.WriteString(`(?&` + n.Name + `)`)
+		case n.Index == 0:
+			sb.WriteString(`(?R)`)
+		default:
+			sb.WriteString(`(?` + strconv.Itoa(n.Index) + `)`)
+		}
+	case OpConditional:
+		sb.WriteString(`(?`)
+		n.Cond.write(sb)
+		for i, sub := range n.Sub {
+			if i > 0 {
+				sb.WriteByte('|')
+			}
+			sub.write(sb)
+		}
+		sb.WriteByte(')')
+	case OpCondition:
+		sb.WriteString(`(` + n.Text + `)`)
+	case OpVerb:
+		sb.WriteString(`(*` + n.Name)
+		if n.Arg != "" {
+			sb.WriteString(":" + n.Arg)
+		}
+		sb.WriteByte(')')
+	case OpCallout:
+		if n.Name != "" {
+			sb.WriteString(`(?C{` + strings.ReplaceAll(n.Name, "}", "}}") + `})`)
+		} else {
+			sb.WriteString(`(?C` + strconv.Itoa(n.Index) + `)`)
+		}
+	case OpOptions:
+		sb.WriteString(`(?` + n.Text + `)`)
+	}
+}
+
+func (n *Node) writeRepeat(sb *strings.Builder) {
+	sub := n.Sub[0]
+	switch sub.Op {
+	case OpEmpty, OpConcat, OpAlternate, OpRepeat:
+		writeNonCapture(sb, sub)
+	default:
+		sub.write(sb)
+	}
+
+	switch {
+	case n.Min == 0 && n.Max == -1:
+		sb.WriteByte('*')
+	case n.Min == 1 && n.Max == -1:
+		sb.WriteByte('+')
+	case n.Min == 0 && n.Max == 1:
+		sb.WriteByte('?')
+	case n.Max == -1:
+		sb.WriteString("{" + strconv.Itoa(n.Min) + ",}")
+	case n.Min == n.Max:
+		sb.WriteString("{" + strconv.Itoa(n.Min) + "}")
+	default:
+		sb.WriteString("{" + strconv.Itoa(n.Min) + "," + strconv.Itoa(n.Max) + "}")
+	}
+
+	mode := n.Mode
+	if n.Flags&Ungreedy != 0 && mode != Possessive {
+		// The meaning of the lazy suffix is inverted in ungreedy mode
+		mode = Lazy - mode
+	}
+
+	switch mode {
+	case Lazy:
+		sb.WriteByte('?')
+	case Possessive:
+		sb.WriteByte('+')
+	}
+}
+
+func (n *Node) writeGroup(sb *strings.Builder) {
+	switch n.Group {
+	case GroupCapture:
+		if n.Name != "" {
+			sb.WriteString(`(?<` + n.Name + `>`)
+		} else {
+			sb.WriteByte('(')
+		}
+	case GroupNonCapture:
+		sb.WriteString(`(?` + n.Text + `:`)
+	case GroupAtomic:
+		sb.WriteString(`(?>`)
+	case GroupBranchReset:
+		sb.WriteString(`(?|`)
+	case GroupLookahead:
+		sb.WriteString(`(?=`)
+	case GroupNegativeLookahead:
+		sb.WriteString(`(?!`)
+	case GroupLookbehind:
+		sb.WriteString(`(?<=`)
+	case GroupNegativeLookbehind:
+		sb.WriteString(`(?<!`)
+	case GroupNonAtomicLookahead:
+		sb.WriteString(`(*napla:`)
+	case GroupNonAtomicLookbehind:
+		sb.WriteString(`(*naplb:`)
+	case GroupScriptRun:
+		sb.WriteString(`(*sr:`)
+	case GroupAtomicScriptRun:
+		sb.WriteString(`(*asr:`)
+	}
+
+	if len(n.Sub) > 0 {
+		n.Sub[0].write(sb)
+	}
+	sb.WriteByte(')')
+}
+
+// writeNonCapture writes n wrapped in a non-capturing group
+func writeNonCapture(sb *strings.Builder, n *Node) {
+	sb.WriteString("(?:")
+	n.write(sb)
+	sb.WriteByte(')')
+}
+
+// writeLiteral writes r, escaping it if it
+// would otherwise have a special meaning.
+func writeLiteral(sb *strings.Builder, r rune, flags Flags) {
+	switch {
+	case flags&Literal != 0 && flags&UTF == 0:
+		sb.WriteByte(byte(r))
+	case flags&Literal != 0:
+		sb.WriteRune(r)
+	case strings.ContainsRune(`\^$.[|()?*+{}`, r):
+		sb.WriteByte('\\')
+		sb.WriteRune(r)
+	case flags&(Extended|ExtendedMore) != 0 && (r == '#' || unicode.IsSpace(r)):
+		writeHex(sb, r, flags)
+	case r < utf8.RuneSelf && unicode.IsPrint(r):
+		sb.WriteRune(r)
+	case flags&UTF != 0 && unicode.IsPrint(r):
+		sb.WriteRune(r)
+	default:
+		writeHex(sb, r, flags)
+	}
+}
+
+// writeHex writes r as a hexadecimal escape sequence
+func writeHex(sb *strings.Builder, r rune, flags Flags) {
+	hex := strconv.FormatInt(int64(r), 16)
+	switch {
+	case flags&AltBsux == 0:
+		sb.WriteString(`\x{` + hex + `}`)
+	case r <= 0xFF:
+		sb.WriteString(`\x` + strings.Repeat("0", 2-len(hex)) + hex)
+	case r <= 0xFFFF:
+		sb.WriteString(`\u` + strings.Repeat("0", 4-len(hex)) + hex)
+	default:
+		sb.WriteRune(r)
+	}
+}
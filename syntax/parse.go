@@ -0,0 +1,1215 @@
+package syntax
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error represents an error encountered while parsing a pattern
+type Error struct {
+	// Offset contains the offset within the pattern at which
+	// the error was found.
+	Offset int
+	Msg    string
+}
+
+// Error returns the error message, prepending the offset
+func (e *Error) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Msg)
+}
+
+// alphaGroups maps the names of alphabetic assertions
+// and groups such as (*pla:...) to their group kinds.
+var alphaGroups = map[string]GroupKind{
+	"atomic":                         GroupAtomic,
+	"pla":                            GroupLookahead,
+	"positive_lookahead":             GroupLookahead,
+	"nla":                            GroupNegativeLookahead,
+	"negative_lookahead":             GroupNegativeLookahead,
+	"plb":                            GroupLookbehind,
+	"positive_lookbehind":            GroupLookbehind,
+	"nlb":                            GroupNegativeLookbehind,
+	"negative_lookbehind":            GroupNegativeLookbehind,
+	"napla":                          GroupNonAtomicLookahead,
+	"non_atomic_positive_lookahead":  GroupNonAtomicLookahead,
+	"naplb":                          GroupNonAtomicLookbehind,
+	"non_atomic_positive_lookbehind": GroupNonAtomicLookbehind,
+	"sr":                             GroupScriptRun,
+	"script_run":                     GroupScriptRun,
+	"asr":                            GroupAtomicScriptRun,
+	"atomic_script_run":              GroupAtomicScriptRun,
+}
+
+// optionFlags maps inline option letters to flags
+var optionFlags = map[byte]Flags{
+	'i': Caseless,
+	'J': DupNames,
+	'm': Multiline,
+	'n': NoAutoCapture,
+	's': DotAll,
+	'U': Ungreedy,
+	'x': Extended,
+}
+
+// startVerbs maps the names of the verbs that set options at the
+// start of a pattern, such as (*UTF), to the flags they set, if any.
+// Verbs that set limits, such as (*LIMIT_MATCH=d), are also accepted.
+var startVerbs = map[string]Flags{
+	"UTF":               UTF,
+	"UCP":               UCP,
+	"NO_AUTO_POSSESS":   0,
+	"NO_DOTSTAR_ANCHOR": 0,
+	"NO_JIT":            0,
+	"NO_START_OPT":      0,
+	"NOTEMPTY":          0,
+	"NOTEMPTY_ATSTART":  0,
+	"CR":                0,
+	"LF":                0,
+	"CRLF":              0,
+	"ANYCRLF":           0,
+	"ANY":               0,
+	"NUL":               0,
+	"BSR_ANYCRLF":       0,
+	"BSR_UNICODE":       0,
+}
+
+// Parse parses the pattern using the given flags
+// and returns the root of its syntax tree.
+func Parse(pattern string, flags Flags) (*Node, error) {
+	p := &parser{src: pattern, flags: flags}
+
+	if flags&Literal != 0 {
+		return p.literal(), nil
+	}
+
+	n, err := p.alternation(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unmatched closing parenthesis")
+	}
+	return n, nil
+}
+
+// parser holds the state of the parser
+type parser struct {
+	src   string
+	pos   int
+	flags Flags
+	// ncap contains the number of capturing groups opened so far
+	ncap int
+	// verbsEnd contains the end of the verbs at the start of
+	// the pattern that set options, such as (*UTF).
+	verbsEnd int
+}
+
+func (p *parser) errorf(format string, args ...any) *Error {
+	return &Error{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) node(op Op, pos int) *Node {
+	return &Node{Op: op, Flags: p.flags, Pos: pos, End: p.pos}
+}
+
+// more reports whether there is more input
+func (p *parser) more() bool {
+	return p.pos < len(p.src)
+}
+
+// lookingAt reports whether the remaining input starts with s
+func (p *parser) lookingAt(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+// next returns the next character, decoding
+// UTF-8 if the UTF flag is set.
+func (p *parser) next() rune {
+	if p.flags&UTF != 0 {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return r
+	}
+	r := rune(p.src[p.pos])
+	p.pos++
+	return r
+}
+
+// literal parses the whole pattern as literal characters
+func (p *parser) literal() *Node {
+	var subs []*Node
+	for p.more() {
+		pos := p.pos
+		n := &Node{Op: OpLiteral, Flags: p.flags, Pos: pos, Rune: p.next()}
+		n.End = p.pos
+		subs = append(subs, n)
+	}
+	return p.concat(subs, 0)
+}
+
+// concat returns a node matching the concatenation of subs
+func (p *parser) concat(subs []*Node, pos int) *Node {
+	switch len(subs) {
+	case 0:
+		return p.node(OpEmpty, pos)
+	case 1:
+		return subs[0]
+	default:
+		n := p.node(OpConcat, pos)
+		n.Sub = subs
+		return n
+	}
+}
+
+// alternation parses alternatives separated by vertical bars until the
+// end of the enclosing group. If branchReset is set, capture numbering
+// restarts for each alternative.
+func (p *parser) alternation(branchReset bool) (*Node, error) {
+	pos := p.pos
+	start, max := p.ncap, p.ncap
+
+	var alts []*Node
+	for {
+		if branchReset {
+			p.ncap = start
+		}
+
+		alt, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, alt)
+
+		if p.ncap > max {
+			max = p.ncap
+		}
+
+		if !p.lookingAt("|") {
+			break
+		}
+		p.pos++
+	}
+	p.ncap = max
+
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	n := p.node(OpAlternate, pos)
+	n.Sub = alts
+	return n, nil
+}
+
+// sequence parses items until the end of the current alternative
+func (p *parser) sequence() (*Node, error) {
+	pos := p.pos
+
+	var subs []*Node
+	for {
+		p.skipExtended()
+		if !p.more() || p.lookingAt("|") || p.lookingAt(")") {
+			break
+		}
+
+		if p.lookingAt(`\Q`) {
+			p.pos += 2
+			subs = append(subs, p.quoted()...)
+		} else {
+			n, err := p.atom()
+			if err != nil {
+				return nil, err
+			}
+			if n != nil {
+				subs = append(subs, n)
+			}
+		}
+
+		if len(subs) == 0 {
+			if p.quantifierFollows() {
+				return nil, p.errorf("quantifier does not follow a repeatable item")
+			}
+			continue
+		}
+
+		last := subs[len(subs)-1]
+		n, err := p.repeat(last)
+		if err != nil {
+			return nil, err
+		}
+		subs[len(subs)-1] = n
+	}
+
+	return p.concat(subs, pos), nil
+}
+
+// quoted parses the literal characters between \Q and \E
+func (p *parser) quoted() []*Node {
+	var subs []*Node
+	for p.more() && !p.lookingAt(`\E`) {
+		pos := p.pos
+		n := &Node{Op: OpLiteral, Flags: p.flags, Pos: pos, Rune: p.next()}
+		n.End = p.pos
+		subs = append(subs, n)
+	}
+	if p.lookingAt(`\E`) {
+		p.pos += 2
+	}
+	return subs
+}
+
+// skipExtended skips whitespace and comments in extended mode
+func (p *parser) skipExtended() {
+	if p.flags&(Extended|ExtendedMore) == 0 {
+		return
+	}
+
+	for p.more() {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\v', '\f', '\r':
+			p.pos++
+		case '#':
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end == -1 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 1
+			}
+		default:
+			return
+		}
+	}
+}
+
+// quantifierFollows reports whether a quantifier follows
+func (p *parser) quantifierFollows() bool {
+	_, _, _, ok := p.scanQuantifier()
+	return ok
+}
+
+// scanQuantifier scans a quantifier at the current
+// position without consuming it.
+func (p *parser) scanQuantifier() (min, max, end int, ok bool) {
+	if !p.more() {
+		return 0, 0, 0, false
+	}
+
+	switch p.src[p.pos] {
+	case '*':
+		return 0, -1, p.pos + 1, true
+	case '+':
+		return 1, -1, p.pos + 1, true
+	case '?':
+		return 0, 1, p.pos + 1, true
+	case '{':
+		closing := strings.IndexByte(p.src[p.pos:], '}')
+		if closing == -1 {
+			return 0, 0, 0, false
+		}
+		body := p.src[p.pos+1 : p.pos+closing]
+		end = p.pos + closing + 1
+
+		minStr, maxStr, hasComma := strings.Cut(body, ",")
+		if !isDigits(minStr) {
+			return 0, 0, 0, false
+		}
+		min, _ = strconv.Atoi(minStr)
+
+		switch {
+		case !hasComma:
+			return min, min, end, true
+		case maxStr == "":
+			return min, -1, end, true
+		case isDigits(maxStr):
+			max, _ = strconv.Atoi(maxStr)
+			return min, max, end, true
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+// repeat parses an optional quantifier following n
+func (p *parser) repeat(n *Node) (*Node, error) {
+	p.skipExtended()
+
+	min, max, end, ok := p.scanQuantifier()
+	if !ok {
+		return n, nil
+	}
+
+	if !repeatable(n) {
+		return nil, p.errorf("quantifier does not follow a repeatable item")
+	}
+	if max != -1 && min > max {
+		return nil, p.errorf("numbers out of order in {} quantifier")
+	}
+	p.pos = end
+
+	// Whitespace may separate a quantifier from its mode in extended mode
+	p.skipExtended()
+
+	rn := &Node{Op: OpRepeat, Flags: p.flags, Pos: n.Pos, Min: min, Max: max, Sub: []*Node{n}}
+	if p.lookingAt("+") {
+		rn.Mode = Possessive
+		p.pos++
+	} else if p.lookingAt("?") {
+		rn.Mode = Lazy
+		p.pos++
+	}
+
+	if p.flags&Ungreedy != 0 && rn.Mode != Possessive {
+		rn.Mode = Lazy - rn.Mode
+	}
+
+	rn.End = p.pos
+	return rn, nil
+}
+
+// repeatable reports whether a quantifier can follow n
+func repeatable(n *Node) bool {
+	switch n.Op {
+	case OpRepeat, OpAssertion, OpResetMatchStart, OpVerb, OpOptions, OpEmpty:
+		return false
+	}
+	return true
+}
+
+// atom parses a single item. It returns nil for
+// items that have no node, such as comments.
+func (p *parser) atom() (*Node, error) {
+	pos := p.pos
+
+	switch c := p.src[p.pos]; c {
+	case '(':
+		return p.group()
+	case '[':
+		return p.class()
+	case '\\':
+		return p.escape()
+	case '.':
+		p.pos++
+		return p.node(OpAnyChar, pos), nil
+	case '^', '$':
+		p.pos++
+		n := p.node(OpAssertion, pos)
+		n.Text = string(c)
+		return n, nil
+	case '*', '+', '?':
+		return nil, p.errorf("quantifier does not follow a repeatable item")
+	}
+
+	n := &Node{Op: OpLiteral, Flags: p.flags, Pos: pos, Rune: p.next()}
+	n.End = p.pos
+	return n, nil
+}
+
+// class parses a character class
+func (p *parser) class() (*Node, error) {
+	pos := p.pos
+	p.pos++
+
+	negated := p.lookingAt("^")
+	if negated {
+		p.pos++
+	}
+	// A closing bracket at the start of a class is a literal
+	if p.lookingAt("]") {
+		p.pos++
+	}
+
+	for {
+		switch {
+		case !p.more():
+			p.pos = pos
+			return nil, p.errorf("missing terminating ] for character class")
+		case p.lookingAt(`\Q`):
+			end := strings.Index(p.src[p.pos:], `\E`)
+			if end == -1 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 2
+			}
+		case p.lookingAt(`\c`):
+			// \c is followed by any character, such as [
+			p.pos += 3
+		case p.lookingAt(`\`):
+			p.pos += 2
+		case p.lookingAt("[:"):
+			end := strings.Index(p.src[p.pos:], ":]")
+			if end == -1 {
+				p.pos++
+			} else {
+				p.pos += end + 2
+			}
+		case p.lookingAt("]"):
+			p.pos++
+			n := p.node(OpCharClass, pos)
+			n.Text = p.src[pos:p.pos]
+			n.Negated = negated
+			return n, nil
+		default:
+			p.pos++
+		}
+	}
+}
+
+// escape parses an escape sequence
+func (p *parser) escape() (*Node, error) {
+	pos := p.pos
+	p.pos++
+	if !p.more() {
+		return nil, p.errorf(`\ at end of pattern`)
+	}
+
+	c := p.src[p.pos]
+	p.pos++
+
+	switch {
+	case c >= '1' && c <= '9':
+		// A number below 10, starting with 8 or 9, or no greater than
+		// the number of previous groups is a backreference. Otherwise,
+		// up to three octal digits are a character code.
+		p.pos--
+		index := p.digits()
+		if index < 10 || c >= '8' || index <= p.ncap {
+			n := p.node(OpBackref, pos)
+			n.Index = index
+			return n, nil
+		}
+
+		p.pos = pos + 1
+		r := rune(0)
+		for i := 0; i < 3 && p.more() && p.src[p.pos] >= '0' && p.src[p.pos] <= '7'; i++ {
+			r = r*8 + rune(p.src[p.pos]-'0')
+			p.pos++
+		}
+		return p.literalNode(r, pos), nil
+	case c == '0':
+		// Up to two more octal digits
+		r := rune(0)
+		for i := 0; i < 2 && p.more() && p.src[p.pos] >= '0' && p.src[p.pos] <= '7'; i++ {
+			r = r*8 + rune(p.src[p.pos]-'0')
+			p.pos++
+		}
+		return p.literalNode(r, pos), nil
+	case c == 'g':
+		return p.gEscape(pos)
+	case c == 'k':
+		name, err := p.delimitedName()
+		if err != nil {
+			return nil, err
+		}
+		n := p.node(OpBackref, pos)
+		n.Name = name
+		return n, nil
+	case c == 'N' && p.lookingAt("{U+"):
+		r, err := p.braced(16, "U+")
+		if err != nil {
+			return nil, err
+		}
+		return p.literalNode(r, pos), nil
+	case strings.IndexByte("dDwWsShHvVNRXC", c) != -1:
+		n := p.node(OpCharType, pos)
+		n.Text = p.src[pos:p.pos]
+		return n, nil
+	case c == 'p' || c == 'P':
+		return p.property(pos, c == 'P')
+	case strings.IndexByte("bBAzZG", c) != -1:
+		n := p.node(OpAssertion, pos)
+		n.Text = p.src[pos:p.pos]
+		return n, nil
+	case c == 'K':
+		return p.node(OpResetMatchStart, pos), nil
+	case c == 'E':
+		// \E without \Q is ignored
+		return nil, nil
+	case c == 'x':
+		return p.hexEscape(pos)
+	case c == 'o':
+		if !p.lookingAt("{") {
+			return nil, p.errorf(`missing opening brace after \o`)
+		}
+		r, err := p.braced(8, "")
+		if err != nil {
+			return nil, err
+		}
+		return p.literalNode(r, pos), nil
+	case c == 'c':
+		if !p.more() {
+			return nil, p.errorf(`\c at end of pattern`)
+		}
+		r := rune(p.src[p.pos])
+		p.pos++
+		if r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		return p.literalNode(r^0x40, pos), nil
+	case c == 'u' && p.flags&AltBsux != 0:
+		if p.pos+4 <= len(p.src) && isHexDigits(p.src[p.pos:p.pos+4]) {
+			r, _ := strconv.ParseInt(p.src[p.pos:p.pos+4], 16, 32)
+			p.pos += 4
+			return p.literalNode(rune(r), pos), nil
+		}
+		return p.literalNode('u', pos), nil
+	case c == 'U' && p.flags&AltBsux != 0:
+		return p.literalNode('U', pos), nil
+	case strings.IndexByte("FLluU", c) != -1:
+		p.pos = pos
+		return nil, p.errorf(`PCRE2 does not support \F, \L, \l, \N{name}, \U, or \u`)
+	}
+
+	if r, ok := simpleEscapes[c]; ok {
+		return p.literalNode(r, pos), nil
+	}
+
+	if isAlnum(c) {
+		p.pos = pos
+		return nil, p.errorf(`unrecognized character follows \`)
+	}
+
+	// Escaped non-alphanumeric characters are literals
+	p.pos--
+	return p.literalNode(p.next(), pos), nil
+}
+
+// simpleEscapes maps escape sequences to the characters they represent
+var simpleEscapes = map[byte]rune{
+	'a': '\a',
+	'e': 0x1B,
+	'f': '\f',
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+}
+
+func (p *parser) literalNode(r rune, pos int) *Node {
+	n := p.node(OpLiteral, pos)
+	n.Rune = r
+	return n
+}
+
+// gEscape parses a \g escape, which is either a
+// backreference or a subroutine call.
+func (p *parser) gEscape(pos int) (*Node, error) {
+	// \g<...> and \g'...' are subroutine calls
+	if p.lookingAt("<") || p.lookingAt("'") {
+		ref, err := p.delimitedName()
+		if err != nil {
+			return nil, err
+		}
+		n := p.node(OpRecursion, pos)
+		p.reference(n, ref, true)
+		return n, nil
+	}
+
+	var ref string
+	if p.lookingAt("{") {
+		var err error
+		ref, err = p.delimitedName()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		start := p.pos
+		if p.lookingAt("-") || p.lookingAt("+") {
+			p.pos++
+		}
+		p.digits()
+		ref = p.src[start:p.pos]
+		if ref == "" {
+			return nil, p.errorf(`a numbered reference must not be zero`)
+		}
+	}
+
+	n := p.node(OpBackref, pos)
+	p.reference(n, ref, false)
+	return n, nil
+}
+
+// reference sets the index or name of n from a group
+// reference, resolving relative references.
+func (p *parser) reference(n *Node, ref string, recursion bool) {
+	if ref == "" || !isDigits(strings.TrimLeft(ref, "+-")) {
+		n.Name = ref
+		return
+	}
+
+	num, _ := strconv.Atoi(ref)
+	switch {
+	case ref[0] == '-':
+		num = p.ncap + num + 1
+	case ref[0] == '+':
+		num = p.ncap + num
+	}
+
+	// Subroutine calls to group 0 recurse the whole pattern
+	if recursion && num == 0 {
+		n.Index = 0
+		return
+	}
+	n.Index = num
+}
+
+// delimitedName parses a name enclosed in angle brackets,
+// single quotes, or braces.
+func (p *parser) delimitedName() (string, error) {
+	if !p.more() {
+		return "", p.errorf("missing group name")
+	}
+
+	var closing byte
+	switch p.src[p.pos] {
+	case '<':
+		closing = '>'
+	case '\'':
+		closing = '\''
+	case '{':
+		closing = '}'
+	default:
+		return "", p.errorf("expected a group name delimiter")
+	}
+
+	end := strings.IndexByte(p.src[p.pos+1:], closing)
+	if end == -1 {
+		return "", p.errorf("missing closing delimiter for group name")
+	}
+
+	name := p.src[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return name, nil
+}
+
+// braced parses a number in the given base enclosed in braces,
+// with an optional prefix.
+func (p *parser) braced(base int, prefix string) (rune, error) {
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end == -1 {
+		return 0, p.errorf("missing closing brace")
+	}
+
+	body := strings.TrimPrefix(p.src[p.pos+1:p.pos+end], prefix)
+	r, err := strconv.ParseInt(body, base, 32)
+	if err != nil {
+		return 0, p.errorf("invalid number in escape sequence")
+	}
+
+	p.pos += end + 1
+	return rune(r), nil
+}
+
+// hexEscape parses a \x escape
+func (p *parser) hexEscape(pos int) (*Node, error) {
+	if p.flags&AltBsux != 0 {
+		// \x must be followed by exactly two hexadecimal digits,
+		// otherwise it represents a literal x.
+		if p.pos+2 <= len(p.src) && isHexDigits(p.src[p.pos:p.pos+2]) {
+			r, _ := strconv.ParseInt(p.src[p.pos:p.pos+2], 16, 32)
+			p.pos += 2
+			return p.literalNode(rune(r), pos), nil
+		}
+		return p.literalNode('x', pos), nil
+	}
+
+	if p.lookingAt("{") {
+		r, err := p.braced(16, "")
+		if err != nil {
+			return nil, err
+		}
+		return p.literalNode(r, pos), nil
+	}
+
+	// Up to two hexadecimal digits
+	r := rune(0)
+	for i := 0; i < 2 && p.more() && isHexDigits(p.src[p.pos:p.pos+1]); i++ {
+		d, _ := strconv.ParseInt(p.src[p.pos:p.pos+1], 16, 32)
+		r = r*16 + rune(d)
+		p.pos++
+	}
+	return p.literalNode(r, pos), nil
+}
+
+// property parses a \p or \P escape
+func (p *parser) property(pos int, negated bool) (*Node, error) {
+	if !p.more() {
+		return nil, p.errorf(`malformed \P or \p sequence`)
+	}
+
+	var name string
+	if p.lookingAt("{") {
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end == -1 {
+			return nil, p.errorf(`malformed \P or \p sequence`)
+		}
+		name = p.src[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+	} else {
+		name = string(p.next())
+	}
+
+	if strings.HasPrefix(name, "^") {
+		name = name[1:]
+		negated = !negated
+	}
+	if name == "" {
+		return nil, p.errorf(`malformed \P or \p sequence`)
+	}
+
+	n := p.node(OpProperty, pos)
+	n.Name = name
+	n.Negated = negated
+	return n, nil
+}
+
+// digits consumes decimal digits and returns their value
+func (p *parser) digits() int {
+	start := p.pos
+	for p.more() && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	num, _ := strconv.Atoi(p.src[start:p.pos])
+	return num
+}
+
+// group parses a parenthesized item
+func (p *parser) group() (*Node, error) {
+	pos := p.pos
+	p.pos++
+
+	if p.lookingAt("*") {
+		return p.verb(pos)
+	}
+
+	if !p.lookingAt("?") {
+		if p.flags&NoAutoCapture != 0 {
+			return p.groupBody(pos, GroupNonCapture, "", p.flags)
+		}
+		return p.capture(pos, "")
+	}
+	p.pos++
+
+	switch {
+	case p.lookingAt("#"):
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end == -1 {
+			p.pos = pos
+			return nil, p.errorf("missing ) at end of comment")
+		}
+		p.pos += end + 1
+		return nil, nil
+	case p.lookingAt(":"):
+		p.pos++
+		return p.groupBody(pos, GroupNonCapture, "", p.flags)
+	case p.lookingAt("|"):
+		p.pos++
+		return p.groupBody(pos, GroupBranchReset, "", p.flags)
+	case p.lookingAt(">"):
+		p.pos++
+		return p.groupBody(pos, GroupAtomic, "", p.flags)
+	case p.lookingAt("="):
+		p.pos++
+		return p.groupBody(pos, GroupLookahead, "", p.flags)
+	case p.lookingAt("!"):
+		p.pos++
+		return p.groupBody(pos, GroupNegativeLookahead, "", p.flags)
+	case p.lookingAt("*"):
+		p.pos++
+		return p.groupBody(pos, GroupNonAtomicLookahead, "", p.flags)
+	case p.lookingAt("<="):
+		p.pos += 2
+		return p.groupBody(pos, GroupLookbehind, "", p.flags)
+	case p.lookingAt("<!"):
+		p.pos += 2
+		return p.groupBody(pos, GroupNegativeLookbehind, "", p.flags)
+	case p.lookingAt("<*"):
+		p.pos += 2
+		return p.groupBody(pos, GroupNonAtomicLookbehind, "", p.flags)
+	case p.lookingAt("<"), p.lookingAt("'"):
+		name, err := p.delimitedName()
+		if err != nil {
+			return nil, err
+		}
+		return p.capture(pos, name)
+	case p.lookingAt("P<"):
+		p.pos++
+		name, err := p.delimitedName()
+		if err != nil {
+			return nil, err
+		}
+		return p.capture(pos, name)
+	case p.lookingAt("P="), p.lookingAt("P>"), p.lookingAt("&"):
+		op := OpRecursion
+		if p.lookingAt("P=") {
+			op = OpBackref
+		}
+		if p.lookingAt("P") {
+			p.pos++
+		}
+		p.pos++
+
+		name, err := p.until(')')
+		if err != nil {
+			return nil, err
+		}
+		n := p.node(op, pos)
+		n.Name = name
+		return n, nil
+	case p.lookingAt("R)"):
+		p.pos += 2
+		return p.node(OpRecursion, pos), nil
+	case p.lookingAt("C"):
+		p.pos++
+		return p.callout(pos)
+	case p.lookingAt("("):
+		return p.conditional(pos)
+	}
+
+	// Numbered and relative subroutine calls
+	if p.more() && (isDigits(p.src[p.pos:p.pos+1]) || p.lookingAt("+") || p.lookingAt("-")) {
+		start := p.pos
+		if !isDigits(p.src[p.pos : p.pos+1]) {
+			p.pos++
+		}
+		if p.more() && isDigits(p.src[p.pos:p.pos+1]) {
+			p.digits()
+			ref := p.src[start:p.pos]
+			if !p.lookingAt(")") {
+				return nil, p.errorf("missing closing parenthesis")
+			}
+			p.pos++
+
+			n := p.node(OpRecursion, pos)
+			p.reference(n, ref, true)
+			return n, nil
+		}
+		p.pos = start
+	}
+
+	return p.options(pos)
+}
+
+// until consumes input up to and including the given
+// character, returning the input before it.
+func (p *parser) until(c byte) (string, error) {
+	end := strings.IndexByte(p.src[p.pos:], c)
+	if end == -1 {
+		return "", p.errorf("missing %q", c)
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// capture parses the body of a capturing group
+func (p *parser) capture(pos int, name string) (*Node, error) {
+	p.ncap++
+	index := p.ncap
+
+	n, err := p.groupBody(pos, GroupCapture, "", p.flags)
+	if err != nil {
+		return nil, err
+	}
+	n.Index = index
+	n.Name = name
+	return n, nil
+}
+
+// groupBody parses the contents of a group up to and including the closing
+// parenthesis, using the given flags inside the group.
+func (p *parser) groupBody(pos int, kind GroupKind, options string, flags Flags) (*Node, error) {
+	saved := p.flags
+	p.flags = flags
+	defer func() { p.flags = saved }()
+
+	body, err := p.alternation(kind == GroupBranchReset)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.lookingAt(")") {
+		p.pos = pos
+		return nil, p.errorf("missing closing parenthesis")
+	}
+	p.pos++
+
+	n := &Node{Op: OpGroup, Flags: saved, Pos: pos, End: p.pos, Group: kind, Text: options}
+	n.Sub = []*Node{body}
+	return n, nil
+}
+
+// options parses an option setting, such as (?i) or (?x-i:...)
+func (p *parser) options(pos int) (*Node, error) {
+	start := p.pos
+	flags := p.flags
+	on := true
+
+	for ; p.more(); p.pos++ {
+		c := p.src[p.pos]
+		switch {
+		case c == ')' || c == ':':
+			text := p.src[start:p.pos]
+			p.pos++
+
+			if c == ':' {
+				return p.groupBody(pos, GroupNonCapture, text, flags)
+			}
+
+			p.flags = flags
+			n := p.node(OpOptions, pos)
+			n.Text = text
+			return n, nil
+		case c == '-' && on:
+			on = false
+		case c == '^' && on && p.pos == start:
+			flags &^= Caseless | Multiline | NoAutoCapture | DotAll | Extended | ExtendedMore
+		case c == 'x' && p.pos+1 < len(p.src) && p.src[p.pos+1] == 'x':
+			p.pos++
+			if on {
+				flags |= Extended | ExtendedMore
+			} else {
+				flags &^= Extended | ExtendedMore
+			}
+		default:
+			flag, ok := optionFlags[c]
+			if !ok {
+				return nil, p.errorf("unrecognized character after (? or (?-")
+			}
+			if on {
+				flags |= flag
+			} else {
+				flags &^= flag
+				if flag == Extended {
+					flags &^= ExtendedMore
+				}
+			}
+		}
+	}
+
+	p.pos = pos
+	return nil, p.errorf("missing closing parenthesis")
+}
+
+// verb parses a backtracking control verb, start-of-pattern
+// setting, or alphabetic assertion.
+func (p *parser) verb(pos int) (*Node, error) {
+	p.pos++
+	start := p.pos
+	for p.more() && (isAlnum(p.src[p.pos]) || p.src[p.pos] == '_' || p.src[p.pos] == '=') {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+
+	if p.lookingAt(":") {
+		if kind, ok := alphaGroups[name]; ok {
+			p.pos++
+			return p.groupBody(pos, kind, "", p.flags)
+		}
+	}
+
+	n := p.node(OpVerb, pos)
+	n.Name = name
+
+	if p.lookingAt(":") {
+		p.pos++
+		arg, err := p.verbArg()
+		if err != nil {
+			return nil, err
+		}
+		n.Arg = arg
+	} else if !p.lookingAt(")") {
+		return nil, p.errorf("(*VERB) not recognized or malformed")
+	} else {
+		p.pos++
+
+		// Verbs at the start of the pattern set options
+		// that apply to the rest of it.
+		if pos == p.verbsEnd {
+			if flags, ok := startVerbs[name]; ok || strings.HasPrefix(name, "LIMIT_") {
+				p.flags |= flags
+				p.verbsEnd = p.pos
+			}
+		}
+	}
+
+	n.End = p.pos
+	return n, nil
+}
+
+// verbArg parses the argument of a verb, including the closing
+// parenthesis. If the AltVerbnames flag is set, backslashes
+// escape the following character.
+func (p *parser) verbArg() (string, error) {
+	if p.flags&AltVerbnames == 0 {
+		return p.until(')')
+	}
+
+	start := p.pos
+	for p.more() {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos += 2
+		case ')':
+			arg := p.src[start:p.pos]
+			p.pos++
+			return arg, nil
+		default:
+			p.pos++
+		}
+	}
+	return "", p.errorf("missing closing parenthesis for verb")
+}
+
+// calloutDelims contains the delimiters of string callouts,
+// which are the same at the start and end.
+const calloutDelims = "`'\"^%#$"
+
+// callout parses a callout
+func (p *parser) callout(pos int) (*Node, error) {
+	n := p.node(OpCallout, pos)
+
+	if !p.more() {
+		return nil, p.errorf("missing closing parenthesis for callout")
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '{' || strings.IndexByte(calloutDelims, c) != -1:
+		closing := c
+		if c == '{' {
+			closing = '}'
+		}
+		p.pos++
+
+		sb := &strings.Builder{}
+		for {
+			if !p.more() {
+				return nil, p.errorf("missing terminating delimiter for callout with string argument")
+			}
+			if p.src[p.pos] == closing {
+				// Doubled delimiters represent a single delimiter
+				if p.pos+1 < len(p.src) && p.src[p.pos+1] == closing {
+					sb.WriteByte(closing)
+					p.pos += 2
+					continue
+				}
+				p.pos++
+				break
+			}
+			sb.WriteByte(p.src[p.pos])
+			p.pos++
+		}
+		n.Name = sb.String()
+	default:
+		n.Index = p.digits()
+		if n.Index > 255 {
+			return nil, p.errorf("number after (?C is greater than 255")
+		}
+	}
+
+	if !p.lookingAt(")") {
+		return nil, p.errorf("closing parenthesis for (?C expected")
+	}
+	p.pos++
+
+	n.End = p.pos
+	return n, nil
+}
+
+// conditional parses a conditional group
+func (p *parser) conditional(pos int) (*Node, error) {
+	var cond *Node
+
+	if strings.HasPrefix(p.src[p.pos:], "(?") || strings.HasPrefix(p.src[p.pos:], "(*") {
+		// The condition is an assertion
+		var err error
+		cond, err = p.group()
+		if err != nil {
+			return nil, err
+		}
+		if cond == nil || cond.Op != OpGroup || !cond.Group.IsLookaround() {
+			return nil, p.errorf("assertion expected after (?( or (?(?C)")
+		}
+	} else {
+		condPos := p.pos
+		p.pos++
+		text, err := p.until(')')
+		if err != nil {
+			return nil, err
+		}
+
+		cond = p.node(OpCondition, condPos)
+		cond.Text = text
+
+		switch {
+		case isDigits(strings.TrimLeft(text, "+-")) && text != "":
+			p.reference(cond, text, false)
+		case strings.HasPrefix(text, "<") || strings.HasPrefix(text, "'"):
+			terminator := "'"
+			if text[0] == '<' {
+				terminator = ">"
+			}
+			if len(text) < 2 || len(text) == 2 && strings.HasSuffix(text, terminator) {
+				p.pos = condPos + 2
+				return nil, p.errorf("subpattern name expected")
+			}
+			if !strings.HasSuffix(text, terminator) {
+				p.pos = condPos + 1 + len(text)
+				return nil, p.errorf("syntax error in subpattern name (missing terminator?)")
+			}
+			cond.Name = text[1 : len(text)-1]
+		case strings.HasPrefix(text, "R&"):
+			cond.Name = text[2:]
+		case strings.HasPrefix(text, "R") && isDigits(text[1:]) && text != "R":
+			cond.Index, _ = strconv.Atoi(text[1:])
+		case text != "R" && text != "DEFINE" && !strings.HasPrefix(text, "VERSION"):
+			cond.Name = text
+		}
+	}
+
+	body, err := p.groupBody(pos, GroupNonCapture, "", p.flags)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{Op: OpConditional, Flags: p.flags, Pos: pos, End: p.pos, Cond: cond}
+	branches := body.Sub[0]
+	if branches.Op == OpAlternate {
+		if len(branches.Sub) > 2 {
+			p.pos = pos
+			return nil, p.errorf("conditional subpattern contains more than two branches")
+		}
+		n.Sub = branches.Sub
+	} else {
+		n.Sub = []*Node{branches}
+	}
+	return n, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if !(s[i] >= '0' && s[i] <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || (c|0x20) >= 'a' && (c|0x20) <= 'z'
+}
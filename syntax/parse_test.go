@@ -0,0 +1,158 @@
+package syntax
+
+import (
+	"testing"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		flags    Flags
+		expected string
+	}{
+		{`a+b*?c{2,3}+d{2,}e{4}`, 0, `a+b*?c{2,3}+d{2,}e{4}`},
+		{`(?<n>x)(?:y|z)(?i)k\k<n>\g{-1}(?&n)(?R)(?1)(?-1)`, 0, `(?<n>x)(?:y|z)(?i)k\k<n>\g{1}(?&n)(?R)(?1)(?1)`},
+		{`(?(1)a|b)(?(?=x)y)(?(<n>)a)(?(DEFINE)(?<n>z))`, 0, `(?(1)a|b)(?(?=x)y)(?(<n>)a)(?(DEFINE)(?<n>z))`},
+		{`[a-z]\d\p{L}\P{^Lu}\pN\x{41}\Qa.b\E+`, 0, `[a-z]\d\p{L}\p{Lu}\p{N}Aa\.b+`},
+		{`(*SKIP)(*MARK:x)(?C1)(?C"a""b")(*pla:a)(?|(a)|(b))(c)`, 0, `(*SKIP)(*MARK:x)(?C1)(?C{a"b})(?=a)(?|(a)|(b))(c)`},
+		{`^\bfoo$\K\z`, 0, `^\bfoo$\K\z`},
+		{`((a))\3a{,3}(?#comment)`, 0, `((a))\g{3}a\{,3\}`},
+		{`(?>a)(?!b)(?<=c)(?<!d)(?*e)(*sr:f)`, 0, `(?>a)(?!b)(?<=c)(?<!d)(*napla:e)(*sr:f)`},
+		{`(?i:a)(?^x: b )(?-i)`, 0, `(?i:a)(?^x:b)(?-i)`},
+		{"a b # comment\n c", Extended, `abc`},
+		{`\ \#`, Extended, `\x{20}\x{23}`},
+		{`(?x)a(?-x) b`, 0, `(?x)a(?-x) b`},
+		{`a.b(c)`, Literal, `a.b(c)`},
+		{`\x41☺\U`, AltBsux, `A\xe2\x98\xbaU`},
+		{`(a)(?<n>b)`, NoAutoCapture, `(?:a)(?<n>b)`},
+		{`a*b*?c*+`, Ungreedy, `a*b*?c*+`},
+		{`\x{263a}é`, UTF, "☺é"},
+		{`\x{263a}`, 0, `\x{263a}`},
+		{`(*UTF)\x{263a}é`, 0, "(*UTF)☺é"},
+		{`(*LIMIT_MATCH=10)(*UCP)(*UTF)é`, 0, "(*LIMIT_MATCH=10)(*UCP)(*UTF)é"},
+		{`a\11b(a)\19\81`, 0, `a\x{9}b(a)\x{1}9\g{81}`},
+		{`[\c[:alpha:]`, 0, `[\c[:alpha:]`},
+		{`a+ +b{2} ?`, Extended, `a++b{2}?`},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.pattern, test.flags)
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err)
+			continue
+		}
+
+		out := n.String()
+		if out != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.pattern, test.expected, out)
+		}
+
+		// Printing the reparsed tree should produce the same result
+		n, err = Parse(out, test.flags)
+		if err != nil {
+			t.Errorf("%s: reparse: %s", out, err)
+		} else if n.String() != out {
+			t.Errorf("%s: reparse produced %s", out, n.String())
+		}
+	}
+}
+
+func TestParseTree(t *testing.T) {
+	n, err := Parse(`(?<word>\w+)|(a|b)*?\1`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n.Op != OpAlternate || len(n.Sub) != 2 {
+		t.Fatalf("expected alternation with 2 branches, got %s", n.Op)
+	}
+
+	group := n.Sub[0]
+	if group.Op != OpGroup || group.Group != GroupCapture || group.Name != "word" || group.Index != 1 {
+		t.Errorf("unexpected named group: %+v", group)
+	}
+	if group.Pos != 0 || group.End != 12 {
+		t.Errorf("expected group at [0 12], got [%d %d]", group.Pos, group.End)
+	}
+
+	concat := n.Sub[1]
+	if concat.Op != OpConcat || len(concat.Sub) != 2 {
+		t.Fatalf("expected concatenation, got %s", concat.Op)
+	}
+
+	repeat := concat.Sub[0]
+	if repeat.Op != OpRepeat || repeat.Min != 0 || repeat.Max != -1 || repeat.Mode != Lazy {
+		t.Errorf("unexpected repeat: %+v", repeat)
+	}
+	if repeat.Sub[0].Index != 2 {
+		t.Errorf("expected group 2, got %d", repeat.Sub[0].Index)
+	}
+
+	backref := concat.Sub[1]
+	if backref.Op != OpBackref || backref.Index != 1 {
+		t.Errorf("unexpected backreference: %+v", backref)
+	}
+}
+
+func TestParseBranchReset(t *testing.T) {
+	n, err := Parse(`(?|(a)|(b)(c))(d)`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var indices []int
+	Walk(n, func(n *Node) bool {
+		if n.Op == OpGroup && n.Group == GroupCapture {
+			indices = append(indices, n.Index)
+		}
+		return true
+	})
+
+	expected := []int{1, 1, 2, 3}
+	if len(indices) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, indices)
+	}
+	for i := range expected {
+		if indices[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, indices)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		pattern string
+		offset  int
+	}{
+		{`(`, 0},
+		{`a)`, 1},
+		{`*a`, 0},
+		{`a**`, 2},
+		{`[a`, 0},
+		{`\`, 1},
+		{`a\L`, 1},
+		{`\i`, 0},
+		{`(?(1)a|b|c)`, 0},
+		{`a{3,2}`, 1},
+		{`(?z)`, 2},
+		{`(*FOO`, 5},
+		{`(?(')`, 4},
+		{`(?(<`, 3},
+		{`(?(<a)a)`, 5},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.pattern, 0)
+		if err == nil {
+			t.Errorf("%s: expected error", test.pattern)
+			continue
+		}
+
+		serr, ok := err.(*Error)
+		if !ok {
+			t.Errorf("%s: expected *Error, got %T", test.pattern, err)
+		} else if serr.Offset != test.offset {
+			t.Errorf("%s: expected offset %d, got %d (%s)", test.pattern, test.offset, serr.Offset, serr)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package syntax_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.elara.ws/pcre"
+	"go.elara.ws/pcre/syntax"
+)
+
+// TestRoundTrip checks that printed trees compile with pcre2
+// and match the same subjects as the original patterns.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		flags    syntax.Flags
+		subjects []string
+	}{
+		{`a\11b`, 0, []string{"a\tb", "a\x01b"}},
+		{`(a)\11`, 0, []string{"a\t", "aa"}},
+		{`(a)\19`, 0, []string{"a\x019", "aa"}},
+		{`(a)(b)(c)(d)(e)(f)(g)(h)(i)(j)(k)\11`, 0, []string{"abcdefghijkk", "abcdefghijk\t"}},
+		{`(a)\1+\12`, 0, []string{"aa\n", "aaa\n"}},
+		{`[\c[:alpha:]+`, 0, []string{"\x1b", ":", "]"}},
+		{`^a+ +b{2} ?$`, syntax.Extended, []string{"aabb", "a bb"}},
+		{`(?<n>a)?(?('n')b|c)`, 0, []string{"ab", "c"}},
+		{`(?i)\d+\K[a-z]\x{41}`, 0, []string{"12bA", "12Ba"}},
+		{`(*UTF)é+`, 0, []string{"éé", "eé"}},
+		{`(*LIMIT_MATCH=10)(*UTF)(*UCP)\w\x{e9}`, 0, []string{"éé", "aé"}},
+	}
+
+	for _, test := range tests {
+		n, err := syntax.Parse(test.pattern, test.flags)
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err)
+			continue
+		}
+		out := n.String()
+
+		orig, err := pcre.CompileOpts(test.pattern, pcre.CompileOption(test.flags))
+		if err != nil {
+			t.Errorf("%s: %s", test.pattern, err)
+			continue
+		}
+		printed, err := pcre.CompileOpts(out, pcre.CompileOption(test.flags))
+		if err != nil {
+			t.Errorf("%s: printed form %s doesn't compile: %s", test.pattern, out, err)
+			orig.Close()
+			continue
+		}
+
+		for _, subject := range test.subjects {
+			expected := orig.FindStringSubmatchIndex(subject)
+			if got := printed.FindStringSubmatchIndex(subject); !reflect.DeepEqual(got, expected) {
+				t.Errorf("%s: printed form %s matched %q at %v, expected %v", test.pattern, out, subject, got, expected)
+			}
+		}
+		orig.Close()
+		printed.Close()
+	}
+}
@@ -0,0 +1,284 @@
+package pcre
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+
+	"modernc.org/libc"
+)
+
+// Tables contains the character tables used by pcre2 for characters
+// below 256 when UTF mode is not enabled. They define which characters
+// match \d, \s, \w and POSIX classes such as [:alpha:], as well as the
+// case of each character for caseless matching.
+//
+// By default, expressions use tables for the C locale, which only
+// classify ASCII characters. Other tables can be used by setting
+// CompileConfig.Tables.
+//
+// Tables are immutable, so they can be shared between expressions.
+type Tables struct {
+	data [lib.DTABLES_LENGTH]byte
+}
+
+// DefaultTables returns the tables generated by pcre2 for the C locale,
+// which are the tables used when no other tables are provided.
+func DefaultTables() *Tables {
+	tls := libc.NewTLS()
+	defer tls.Close()
+
+	p := lib.Xpcre2_maketables_8(tls, 0)
+	if p == 0 {
+		panic("error creating character tables")
+	}
+	defer lib.Xpcre2_maketables_free_8(tls, 0, p)
+
+	t := &Tables{}
+	copy(t.data[:], unsafe.Slice((*byte)(unsafe.Pointer(p)), len(t.data)))
+	return t
+}
+
+// MakeTables generates character tables for a single-byte character set.
+// decode returns the Unicode character represented by each byte, or
+// utf8.RuneError if the byte doesn't represent a character.
+//
+// Characters are classified using the unicode package, following the
+// conventions of the POSIX character classes: only '0' to '9' are digits,
+// spaces include the ASCII whitespace characters and non-breaking spaces
+// are excluded, and an underscore is a word character. Each byte's other
+// case is used for caseless matching if it's in the character set.
+func MakeTables(decode func(b byte) rune) *Tables {
+	var runes [256]rune
+	encode := make(map[rune]byte, len(runes))
+	for i := range runes {
+		r := decode(byte(i))
+		runes[i] = r
+		if r == utf8.RuneError {
+			continue
+		}
+		// The first byte representing a character is used for its case
+		if _, ok := encode[r]; !ok {
+			encode[r] = byte(i)
+		}
+	}
+
+	// toCase returns the byte representing the character in
+	// the given case, or c if it's not in the character set.
+	toCase := func(c byte, caseType int) byte {
+		if runes[c] == utf8.RuneError {
+			return c
+		}
+		if b, ok := encode[unicode.To(caseType, runes[c])]; ok {
+			return b
+		}
+		return c
+	}
+
+	t := &Tables{}
+	lcc := t.data[lib.Dlcc_offset:]
+	fcc := t.data[lib.Dfcc_offset:]
+	cbits := t.data[lib.Dcbits_offset:]
+	ctypes := t.data[lib.Dctypes_offset:]
+
+	for i, r := range runes {
+		c := byte(i)
+		class := classify(r)
+
+		lcc[i] = toCase(c, unicode.LowerCase)
+		if class&classLower != 0 {
+			fcc[i] = toCase(c, unicode.UpperCase)
+		} else {
+			fcc[i] = lcc[i]
+		}
+
+		setBit := func(offset int) {
+			cbits[offset+i/8] |= 1 << (i & 7)
+		}
+		var ctype byte
+		if class&classDigit != 0 {
+			setBit(lib.Dcbit_digit)
+			ctype |= lib.Dctype_digit
+		}
+		if class&classUpper != 0 {
+			setBit(lib.Dcbit_upper)
+		}
+		if class&classLower != 0 {
+			setBit(lib.Dcbit_lower)
+			ctype |= lib.Dctype_lcletter
+		}
+		if class&classAlpha != 0 {
+			ctype |= lib.Dctype_letter
+		}
+		if class&(classAlpha|classDigit) != 0 || r == '_' {
+			setBit(lib.Dcbit_word)
+			ctype |= lib.Dctype_word
+		}
+		if class&classSpace != 0 {
+			setBit(lib.Dcbit_space)
+			ctype |= lib.Dctype_space
+		}
+		if class&classXDigit != 0 {
+			setBit(lib.Dcbit_xdigit)
+		}
+		if class&classGraph != 0 {
+			setBit(lib.Dcbit_graph)
+		}
+		if class&classPrint != 0 {
+			setBit(lib.Dcbit_print)
+		}
+		if class&classPunct != 0 {
+			setBit(lib.Dcbit_punct)
+		}
+		if class&classCntrl != 0 {
+			setBit(lib.Dcbit_cntrl)
+		}
+		ctypes[i] = ctype
+	}
+
+	return t
+}
+
+// charClass is a set of POSIX character classes
+type charClass uint16
+
+const (
+	classDigit charClass = 1 << iota
+	classXDigit
+	classUpper
+	classLower
+	classAlpha
+	classSpace
+	classGraph
+	classPrint
+	classPunct
+	classCntrl
+)
+
+// classify returns the POSIX character classes of r
+func classify(r rune) charClass {
+	if r == utf8.RuneError {
+		return 0
+	}
+
+	var class charClass
+	switch {
+	case r >= '0' && r <= '9':
+		class |= classDigit | classXDigit
+	case r >= 'a' && r <= 'f', r >= 'A' && r <= 'F':
+		class |= classXDigit
+	}
+	if unicode.IsLetter(r) {
+		class |= classAlpha
+		if unicode.IsUpper(r) {
+			class |= classUpper
+		}
+		if unicode.IsLower(r) {
+			class |= classLower
+		}
+	}
+	switch r {
+	case '\t', '\n', '\v', '\f', '\r':
+		class |= classSpace
+	case '\u00a0', '\u2007', '\u202f':
+		// Non-breaking spaces are not spaces in POSIX locales
+	default:
+		if unicode.In(r, unicode.Zs, unicode.Zl, unicode.Zp) {
+			class |= classSpace
+		}
+	}
+	if unicode.IsControl(r) {
+		class |= classCntrl
+	} else if unicode.IsGraphic(r) {
+		class |= classPrint
+		if !unicode.In(r, unicode.Zs, unicode.Zl, unicode.Zp) {
+			class |= classGraph
+			if class&(classAlpha|classDigit) == 0 {
+				class |= classPunct
+			}
+		}
+	}
+	return class
+}
+
+// LocaleTables returns the character tables for the named locale,
+// or an error if the locale is not known. Names are case-insensitive.
+// The following locales are available:
+//
+//	C, POSIX                 ASCII only, same as DefaultTables
+//	ISO-8859-1, Latin1       Western European
+//	ISO-8859-15, Latin9      Western European with the euro sign
+//	Windows-1252, CP1252     Windows Western European
+func LocaleTables(name string) (*Tables, error) {
+	switch strings.ToLower(name) {
+	case "c", "posix":
+		return MakeTables(decodeASCII), nil
+	case "iso-8859-1", "iso8859-1", "latin1":
+		return MakeTables(decodeLatin1), nil
+	case "iso-8859-15", "iso8859-15", "latin9":
+		return MakeTables(decodeLatin9), nil
+	case "windows-1252", "cp1252":
+		return MakeTables(decodeWindows1252), nil
+	default:
+		return nil, fmt.Errorf("unknown locale: %q", name)
+	}
+}
+
+// Bytes returns a copy of the tables in pcre2's binary format,
+// as written by pcre2_dftables.
+func (t *Tables) Bytes() []byte {
+	out := make([]byte, len(t.data))
+	copy(out, t.data[:])
+	return out
+}
+
+// ptr returns a pointer to the tables for pcre2. The tables must be
+// kept alive for as long as code compiled with them is in use.
+func (t *Tables) ptr() uintptr {
+	return uintptr(unsafe.Pointer(&t.data[0]))
+}
+
+func decodeASCII(b byte) rune {
+	if b >= utf8.RuneSelf {
+		return utf8.RuneError
+	}
+	return rune(b)
+}
+
+func decodeLatin1(b byte) rune {
+	return rune(b)
+}
+
+// latin9Diff contains the characters of ISO-8859-15
+// that differ from ISO-8859-1
+var latin9Diff = map[byte]rune{
+	0xa4: '€', 0xa6: 'Š', 0xa8: 'š', 0xb4: 'Ž',
+	0xb8: 'ž', 0xbc: 'Œ', 0xbd: 'œ', 0xbe: 'Ÿ',
+}
+
+func decodeLatin9(b byte) rune {
+	if r, ok := latin9Diff[b]; ok {
+		return r
+	}
+	return rune(b)
+}
+
+// windows1252High contains the characters of Windows-1252 from 0x80
+// to 0x9f, where it differs from ISO-8859-1. Unused bytes are RuneError.
+var windows1252High = [32]rune{
+	'€', utf8.RuneError, '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', utf8.RuneError, 'Ž', utf8.RuneError,
+	utf8.RuneError, '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', utf8.RuneError, 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(b byte) rune {
+	if b >= 0x80 && b < 0xa0 {
+		return windows1252High[b-0x80]
+	}
+	return rune(b)
+}
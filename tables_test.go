@@ -0,0 +1,99 @@
+package pcre_test
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestLocaleTablesC(t *testing.T) {
+	tables, err := pcre.LocaleTables("C")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tables generated in Go should be the same as
+	// the ones pcre2 generates for the C locale.
+	if !bytes.Equal(tables.Bytes(), pcre.DefaultTables().Bytes()) {
+		t.Error("expected C locale tables to match pcre2's default tables")
+	}
+}
+
+func TestLocaleTablesUnknown(t *testing.T) {
+	if _, err := pcre.LocaleTables("klingon"); err == nil {
+		t.Error("expected error for unknown locale")
+	}
+}
+
+func TestTablesLatin1(t *testing.T) {
+	tables, err := pcre.LocaleTables("latin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mustCompileWith(t, `^\w+$`, pcre.CompileConfig{Tables: tables})
+	defer r.Close()
+
+	// "café" and "ÉTÉ" in ISO-8859-1
+	if !r.Match([]byte("caf\xe9")) {
+		t.Error("expected é to be a word character")
+	}
+	if r.Match([]byte("caf\xe9\xa0")) {
+		t.Error("expected non-breaking space not to be a word character")
+	}
+
+	caseless := mustCompileWith(t, `\xe9t\xe9`, pcre.CompileConfig{
+		Options: pcre.Caseless,
+		Tables:  tables,
+	})
+	defer caseless.Close()
+	if !caseless.Match([]byte("\xc9T\xc9")) {
+		t.Error("expected caseless match of É with é")
+	}
+
+	// Without the tables, only ASCII characters are word characters
+	def := pcre.MustCompile(`^\w+$`)
+	defer def.Close()
+	if def.Match([]byte("caf\xe9")) {
+		t.Error("expected é not to be a word character in the C locale")
+	}
+}
+
+func TestTablesCustom(t *testing.T) {
+	// A character set where 'x' represents 'Ω'
+	tables := pcre.MakeTables(func(b byte) rune {
+		if b == 'x' {
+			return 'Ω'
+		}
+		if b == 'X' {
+			return 'ω'
+		}
+		return rune(b)
+	})
+
+	r := mustCompileWith(t, `(?i)x`, pcre.CompileConfig{Tables: tables})
+	if !r.MatchString("X") {
+		t.Error("expected x to match X caselessly")
+	}
+
+	// The clone refers to the same tables, which have to stay alive
+	clone := r.Clone()
+	r.Close()
+	tables = nil
+	runtime.GC()
+	if !clone.MatchString("X") {
+		t.Error("expected clone to match using the tables")
+	}
+	clone.Close()
+}
+
+func mustCompileWith(t *testing.T, pattern string, config pcre.CompileConfig) *pcre.Regexp {
+	t.Helper()
+	r, err := pcre.CompileWith(pattern, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
@@ -0,0 +1,215 @@
+package pcre
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TraceStep represents a single step of a traced match,
+// as reported by an automatic callout.
+type TraceStep struct {
+	// CalloutNumber contains the number of the callout that produced
+	// this step. Automatic callouts always have the number 255.
+	CalloutNumber uint32
+
+	// StartMatch contains the offset within the subject at which
+	// the current match attempt started.
+	StartMatch uint
+
+	// SubjectPosition contains the offset of the current
+	// match pointer within the subject.
+	SubjectPosition uint
+
+	// PatternPosition contains the offset within the pattern
+	// of the next item to be matched.
+	PatternPosition uint
+
+	// NextItem contains the next item to be matched in the pattern.
+	NextItem string
+
+	// CalloutFlags contains the flags passed to the callout. See
+	// the CalloutFlags field of CalloutBlock for more information.
+	CalloutFlags CalloutFlags
+}
+
+// Backtrack reports whether there has been a backtrack
+// since the previous step.
+func (ts TraceStep) Backtrack() bool {
+	return ts.CalloutFlags&CalloutBacktrack != 0
+}
+
+// NewStart reports whether this is the first step
+// at a new starting position in the subject.
+func (ts TraceStep) NewStart() bool {
+	return ts.CalloutFlags&CalloutStartMatch != 0
+}
+
+// Trace contains every step taken while matching
+// a regular expression against a subject.
+type Trace struct {
+	// Pattern is the regular expression that was traced.
+	Pattern string
+
+	// Subject is the string the expression was matched against.
+	Subject string
+
+	// Steps contains the steps of the match, in order.
+	Steps []TraceStep
+
+	// Match contains the location of the match in the subject,
+	// or nil if the expression did not match.
+	Match []int
+}
+
+// Trace matches the regular expression against subject and records every
+// step of the match. The expression is recompiled with the AutoCallout
+// option, so any callout set using SetCallout is not called.
+func (r *Regexp) Trace(subject string) (*Trace, error) {
+	if err := r.acquire(); err != nil {
+		return nil, err
+	}
+	defer r.release()
+
+	t := &Trace{
+		Pattern: r.expr,
+		Subject: subject,
+	}
+
+	match, err := r.autoCallout(subject, func(cb *CalloutBlock) {
+		t.Steps = append(t.Steps, TraceStep{
+			CalloutNumber:   cb.CalloutNumber,
+			StartMatch:      cb.StartMatch,
+			SubjectPosition: cb.CurrentPosition,
+			PatternPosition: cb.PatternPosition,
+			NextItem:        nextItem(r.expr, cb.PatternPosition, cb.NextItemLength),
+			CalloutFlags:    cb.CalloutFlags,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Match = match
+
+	return t, nil
+}
+
+// String renders the trace as text. See WriteTo for details.
+func (t *Trace) String() string {
+	sb := &strings.Builder{}
+	t.WriteTo(sb)
+	return sb.String()
+}
+
+// WriteTo renders the trace as text and writes it to w.
+//
+// The first line contains the subject. Every following line represents
+// a step, and contains the pattern position, the subject with a cursor
+// at the start of the current match attempt and another at the current
+// position, and the next item in the pattern, followed by any flags
+// that were set for that step. The last line contains the result.
+// For example, tracing `a\d` against "aab1" produces:
+//
+//	--->aab1
+//	 +0 ^       a (start)
+//	 +1 ^^      \d
+//	 +0  ^      a (start) (backtrack)
+//	 +1  ^^     \d
+//	No match
+func (t *Trace) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+
+	n, err := fmt.Fprintf(w, "--->%s\n", printable(t.Subject))
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+
+	for _, step := range t.Steps {
+		cursor := []byte(strings.Repeat(" ", len(t.Subject)+1))
+		if step.StartMatch < uint(len(cursor)) {
+			cursor[step.StartMatch] = '^'
+		}
+		if step.SubjectPosition < uint(len(cursor)) {
+			cursor[step.SubjectPosition] = '^'
+		}
+
+		line := fmt.Sprintf("%3s %s   %s", fmt.Sprintf("+%d", step.PatternPosition), cursor, step.NextItem)
+		if step.NewStart() {
+			line += " (start)"
+		}
+		if step.Backtrack() {
+			line += " (backtrack)"
+		}
+
+		n, err = fmt.Fprintln(w, strings.TrimRight(line, " "))
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	if t.Match == nil {
+		n, err = fmt.Fprintln(w, "No match")
+	} else {
+		n, err = fmt.Fprintf(w, "Match: %q\n", t.Subject[t.Match[0]:t.Match[1]])
+	}
+	total += int64(n)
+	return total, err
+}
+
+// autoCallout compiles the regular expression with the AutoCallout option,
+// matches it against subject, and calls fn for every callout. It returns
+// the location of the match, or nil if there was no match.
+func (r *Regexp) autoCallout(subject string, fn func(cb *CalloutBlock)) ([]int, error) {
+	config := r.config
+	config.Options |= AutoCallout
+	ar, err := CompileWith(r.expr, config)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	err = ar.SetCallout(func(cb *CalloutBlock) int32 {
+		fn(cb)
+		return 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := ar.match([]byte(subject), 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	return []int{int(matches[0][0]), int(matches[0][1])}, nil
+}
+
+// nextItem returns the item of the given length at
+// the given position in the pattern.
+func nextItem(pattern string, pos, length uint) string {
+	if pos > uint(len(pattern)) {
+		return ""
+	}
+	end := pos + length
+	if end > uint(len(pattern)) {
+		end = uint(len(pattern))
+	}
+	return pattern[pos:end]
+}
+
+// printable replaces every non-printable byte in s with a dot, so
+// that each byte of the subject takes up exactly one column.
+func printable(s string) string {
+	out := []byte(s)
+	for i, c := range out {
+		if c < ' ' || c > '~' {
+			out[i] = '.'
+		}
+	}
+	return string(out)
+}
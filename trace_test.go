@@ -0,0 +1,100 @@
+package pcre_test
+
+import (
+	"strings"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestTrace(t *testing.T) {
+	r := pcre.MustCompile(`a\d`)
+	defer r.Close()
+
+	trace, err := r.Trace("aab1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trace.Match != nil {
+		t.Errorf("expected no match, got %v", trace.Match)
+	}
+
+	if len(trace.Steps) != 4 {
+		t.Fatalf("expected 4 steps, got %d", len(trace.Steps))
+	}
+
+	first := trace.Steps[0]
+	if first.NextItem != "a" || !first.NewStart() || first.Backtrack() {
+		t.Errorf("unexpected first step: %+v", first)
+	}
+
+	third := trace.Steps[2]
+	if third.StartMatch != 1 || !third.Backtrack() {
+		t.Errorf("expected backtrack to offset 1, got %+v", third)
+	}
+
+	expected := "--->aab1\n" +
+		" +0 ^       a (start)\n" +
+		" +1 ^^      \\d\n" +
+		" +0  ^      a (start) (backtrack)\n" +
+		" +1  ^^     \\d\n" +
+		"No match\n"
+	if trace.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, trace.String())
+	}
+}
+
+func TestTraceMatch(t *testing.T) {
+	r := pcre.MustCompile(`\d+x`)
+	defer r.Close()
+
+	trace, err := r.Trace("12y3x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trace.Match == nil || trace.Match[0] != 3 || trace.Match[1] != 5 {
+		t.Fatalf("expected match at [3 5], got %v", trace.Match)
+	}
+
+	last := trace.Steps[len(trace.Steps)-1]
+	if last.SubjectPosition != 5 || last.NextItem != "" {
+		t.Errorf("unexpected last step: %+v", last)
+	}
+
+	if !strings.HasSuffix(trace.String(), "Match: \"3x\"\n") {
+		t.Errorf("expected trace to end with match, got:\n%s", trace.String())
+	}
+}
+
+func TestTraceTables(t *testing.T) {
+	// A character set where 0xd9 represents 'Ω'
+	tables := pcre.MakeTables(func(b byte) rune {
+		if b == 0xd9 {
+			return 'Ω'
+		}
+		return rune(b)
+	})
+
+	// The traced expression has to be compiled with the same
+	// tables, which make 0xd9 a word character.
+	r := mustCompileWith(t, `\w+`, pcre.CompileConfig{Tables: tables})
+	defer r.Close()
+
+	trace, err := r.Trace("-\xd9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Match == nil || trace.Match[0] != 1 || trace.Match[1] != 2 {
+		t.Errorf("expected match at [1 2], got %v", trace.Match)
+	}
+
+	stats, err := r.Profile("-\xd9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.Matched {
+		t.Error("expected profiled match")
+	}
+}
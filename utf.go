@@ -0,0 +1,162 @@
+package pcre
+
+import (
+	"fmt"
+	"runtime"
+	"unicode/utf8"
+	"unsafe"
+
+	"go.elara.ws/pcre/lib"
+
+	"modernc.org/libc"
+)
+
+// UTFPolicy determines how an expression compiled in UTF mode handles
+// subjects that contain invalid UTF-8. It has no effect otherwise.
+type UTFPolicy int
+
+const (
+	// UTFReject makes matching fail with a *UTFError if the subject
+	// contains invalid UTF-8. Methods that don't return errors panic
+	// with the *UTFError, as they do with other match errors.
+	UTFReject UTFPolicy = iota
+
+	// UTFSkip removes invalid UTF-8 sequences from the subject before
+	// matching, so it matches as if they weren't there. Offsets still
+	// refer to the original subject, and matches don't include invalid
+	// sequences at their start or end.
+	UTFSkip
+
+	// UTFNoMatch treats invalid UTF-8 sequences as characters that
+	// can't be matched by anything, using the MatchInvalidUTF option.
+	UTFNoMatch
+)
+
+// String returns the name of the policy
+func (p UTFPolicy) String() string {
+	switch p {
+	case UTFReject:
+		return "reject"
+	case UTFSkip:
+		return "skip"
+	case UTFNoMatch:
+		return "no match"
+	default:
+		return fmt.Sprintf("UTFPolicy(%d)", int(p))
+	}
+}
+
+// UTFPolicy returns the UTF policy used by the expression. Expressions
+// compiled with the MatchInvalidUTF option use UTFNoMatch.
+func (r *Regexp) UTFPolicy() UTFPolicy {
+	return r.utfPolicy
+}
+
+// UTFError is returned when a subject contains invalid UTF-8
+type UTFError struct {
+	// Offset is the byte offset of the invalid sequence
+	Offset int
+	// Code is the pcre2 error code describing the problem,
+	// from PCRE2_ERROR_UTF8_ERR1 (-3) to PCRE2_ERROR_UTF8_ERR21 (-23).
+	Code int
+
+	msg string
+}
+
+// Error returns the error message
+func (e *UTFError) Error() string {
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.msg)
+}
+
+// isUTFError reports whether code is one of pcre2's UTF-8 error codes
+func isUTFError(code int32) bool {
+	return code <= lib.DPCRE2_ERROR_UTF8_ERR1 && code >= lib.DPCRE2_ERROR_UTF8_ERR21
+}
+
+// newUTFError creates a UTF error with the given code and offset
+func newUTFError(tls *libc.TLS, code int32, offset lib.Tsize_t) *UTFError {
+	return &UTFError{
+		Offset: int(offset),
+		Code:   int(code),
+		msg:    codeToError(tls, code).errStr,
+	}
+}
+
+// ValidateUTF checks whether b is valid UTF-8, as pcre2 does before
+// matching in UTF mode. It returns nil if b is valid, or a *UTFError
+// describing the first invalid sequence.
+func ValidateUTF(b []byte) error {
+	tls := libc.NewTLS()
+	defer tls.Close()
+
+	var offset lib.Tsize_t
+	code := lib.X_pcre2_valid_utf_8(tls, subjectPointer(b), lib.Tsize_t(len(b)), uintptr(unsafe.Pointer(&offset)))
+	runtime.KeepAlive(b)
+	if code == 0 {
+		return nil
+	}
+	return newUTFError(tls, code, offset)
+}
+
+// ValidateUTFString is the String version of ValidateUTF
+func ValidateUTFString(s string) error {
+	return ValidateUTF(stringBytes(s))
+}
+
+// skippedUTF maps offsets in a subject with invalid UTF-8 sequences
+// removed, as done by UTFSkip, back to offsets in the original subject.
+type skippedUTF struct {
+	// offsets contains the offset in the original subject of each byte
+	// of the cleaned subject, followed by the original subject's length.
+	// It's nil if the original subject was valid.
+	offsets []int
+}
+
+// skipInvalidUTF returns b with invalid UTF-8 sequences removed, if
+// the expression uses UTFSkip, along with the mapping of its offsets.
+// b is returned unchanged if it's valid.
+func (r *Regexp) skipInvalidUTF(b []byte) ([]byte, skippedUTF) {
+	if !r.utf || r.utfPolicy != UTFSkip || utf8.Valid(b) {
+		return b, skippedUTF{}
+	}
+
+	clean := make([]byte, 0, len(b))
+	offsets := make([]int, 0, len(b)+1)
+	for i := 0; i < len(b); {
+		c, size := utf8.DecodeRune(b[i:])
+		if c != utf8.RuneError || size > 1 {
+			clean = append(clean, b[i:i+size]...)
+			for j := i; j < i+size; j++ {
+				offsets = append(offsets, j)
+			}
+		}
+		i += size
+	}
+	offsets = append(offsets, len(b))
+	return clean, skippedUTF{offsets}
+}
+
+// pair converts the start and end offsets of a match or submatch
+// in the cleaned subject to offsets in the original subject.
+// Negative offsets, used for unset submatches, are kept.
+func (s skippedUTF) pair(start, end int) (int, int) {
+	if s.offsets == nil || start < 0 {
+		return start, end
+	}
+	if start == end {
+		return s.offsets[start], s.offsets[start]
+	}
+	// The end is placed after the last byte of the match, rather
+	// than before the next valid byte, to exclude invalid sequences.
+	return s.offsets[start], s.offsets[end-1] + 1
+}
+
+// remap converts the index pairs in idx in place
+func (s skippedUTF) remap(idx []int) {
+	if s.offsets == nil {
+		return
+	}
+	for i := 0; i+1 < len(idx); i += 2 {
+		idx[i], idx[i+1] = s.pair(idx[i], idx[i+1])
+	}
+}
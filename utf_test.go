@@ -0,0 +1,149 @@
+package pcre_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.elara.ws/pcre"
+)
+
+func TestValidateUTF(t *testing.T) {
+	if err := pcre.ValidateUTFString("héllo 😀"); err != nil {
+		t.Errorf("expected valid UTF-8, got %v", err)
+	}
+	if err := pcre.ValidateUTF(nil); err != nil {
+		t.Errorf("expected empty subject to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		subject string
+		offset  int
+		code    int
+	}{
+		// Truncated character at the end
+		{"ab\xc3", 2, -3},
+		// Isolated continuation byte
+		{"abc\x80", 3, -22},
+		// Overlong encoding
+		{"a\xc0\x80", 1, -17},
+		// Surrogate
+		{"\xed\xa0\x80", 0, -16},
+	}
+	for _, tt := range tests {
+		err := pcre.ValidateUTFString(tt.subject)
+		var ue *pcre.UTFError
+		if !errors.As(err, &ue) {
+			t.Errorf("%q: expected UTF error, got %v", tt.subject, err)
+			continue
+		}
+		if ue.Offset != tt.offset || ue.Code != tt.code {
+			t.Errorf("%q: expected offset %d and code %d, got %d and %d", tt.subject, tt.offset, tt.code, ue.Offset, ue.Code)
+		}
+	}
+}
+
+func TestUTFReject(t *testing.T) {
+	r := pcre.MustCompileOpts(`b`, pcre.UTF)
+	defer r.Close()
+
+	if r.UTFPolicy() != pcre.UTFReject {
+		t.Errorf("expected reject policy, got %v", r.UTFPolicy())
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		var ue *pcre.UTFError
+		if !errors.As(err, &ue) {
+			t.Fatalf("expected panic with UTF error, got %v", err)
+		}
+		expected := pcre.ValidateUTFString("a\xffb")
+		if !reflect.DeepEqual(err, expected) {
+			t.Errorf("expected %v, got %v", expected, err)
+		}
+	}()
+	r.MatchString("a\xffb")
+}
+
+func TestUTFSkip(t *testing.T) {
+	r, err := pcre.CompileWith(`a(b+)c|x`, pcre.CompileConfig{
+		Options:   pcre.UTF,
+		UTFPolicy: pcre.UTFSkip,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	subject := "\xffa\xffbb\x80c\xfex"
+	expected := [][]int{{1, 7, 3, 5}, {8, 9, -1, -1}}
+	if got := r.FindAllStringSubmatchIndex(subject, -1); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := r.FindLastStringSubmatchIndex(subject); !reflect.DeepEqual(got, expected[1]) {
+		t.Errorf("expected last match %v, got %v", expected[1], got)
+	}
+	if got := r.FindAllOverlappingIndex([]byte(subject), -1); !reflect.DeepEqual(got, [][]int{{1, 7}, {8, 9}}) {
+		t.Errorf("unexpected overlapping matches %v", got)
+	}
+
+	md := r.NewMatchData()
+	defer md.Close()
+	if got := md.FindStringSubmatchIndexInto(nil, subject); !reflect.DeepEqual(got, expected[0]) {
+		t.Errorf("expected match data result %v, got %v", expected[0], got)
+	}
+	if n := md.CountAllString(subject); n != 2 {
+		t.Errorf("expected 2 matches, got %d", n)
+	}
+}
+
+func TestUTFNoMatch(t *testing.T) {
+	r, err := pcre.CompileWith(`a.b|c`, pcre.CompileConfig{
+		Options:   pcre.UTF,
+		UTFPolicy: pcre.UTFNoMatch,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.UTFPolicy() != pcre.UTFNoMatch {
+		t.Errorf("expected no match policy, got %v", r.UTFPolicy())
+	}
+	if r.MatchString("a\xffb") {
+		t.Error("expected invalid sequence not to match")
+	}
+	if got := r.FindStringIndex("a\xffbc"); !reflect.DeepEqual(got, []int{3, 4}) {
+		t.Errorf("expected [3 4], got %v", got)
+	}
+
+	// The policy doesn't enable UTF mode for other expressions
+	bytes, err := pcre.CompileWith(`^.$`, pcre.CompileConfig{UTFPolicy: pcre.UTFNoMatch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bytes.Close()
+	if bytes.MatchString("é") {
+		t.Error("expected é to be two characters without UTF mode")
+	}
+	if !bytes.MatchString("\xff") {
+		t.Error("expected invalid UTF-8 to match without UTF mode")
+	}
+
+	// Patterns that enable UTF mode themselves also use the policy
+	verb, err := pcre.CompileWith(`(*UTF)a.b`, pcre.CompileConfig{UTFPolicy: pcre.UTFNoMatch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer verb.Close()
+	if matched, err := verb.MatchStringErr("a\xffb aéb"); !matched || err != nil {
+		t.Errorf("expected aéb to match, got %t (%v)", matched, err)
+	}
+
+	// The MatchInvalidUTF option uses the same policy
+	opt := pcre.MustCompileOpts(`a`, pcre.MatchInvalidUTF)
+	defer opt.Close()
+	if opt.UTFPolicy() != pcre.UTFNoMatch {
+		t.Errorf("expected no match policy, got %v", opt.UTFPolicy())
+	}
+}